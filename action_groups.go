@@ -0,0 +1,111 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "sync"
+
+// ActionGroups is a registry of named groups of actions. A policy which refers to a group by its name applies to all
+// actions of the group. Groups may contain other groups, for example "admin" may contain "write" which contains
+// "read", "create" and "update". Because groups are resolved when a request is evaluated, changing a group takes
+// effect for all policies without rewriting them. ActionGroups is safe for concurrent use.
+type ActionGroups struct {
+	sync.RWMutex
+
+	// groups maps the name of a group to its members.
+	groups map[string][]string
+
+	// parents maps an action or group to the groups it is a direct member of.
+	parents map[string][]string
+}
+
+// NewActionGroups returns an ActionGroups registry containing the given groups.
+func NewActionGroups(groups map[string][]string) *ActionGroups {
+	g := &ActionGroups{groups: map[string][]string{}}
+	for name, actions := range groups {
+		g.groups[name] = actions
+	}
+	g.index()
+	return g
+}
+
+// Set defines the group name to contain the given actions and groups, replacing any previous definition.
+func (g *ActionGroups) Set(name string, actions ...string) {
+	g.Lock()
+	defer g.Unlock()
+	if g.groups == nil {
+		g.groups = map[string][]string{}
+	}
+	g.groups[name] = actions
+	g.index()
+}
+
+// Delete removes the group name.
+func (g *ActionGroups) Delete(name string) {
+	g.Lock()
+	defer g.Unlock()
+	delete(g.groups, name)
+	g.index()
+}
+
+// Get returns the actions and groups the group name directly contains.
+func (g *ActionGroups) Get(name string) ([]string, bool) {
+	g.RLock()
+	defer g.RUnlock()
+	actions, ok := g.groups[name]
+	return actions, ok
+}
+
+// Resolve returns the action followed by all groups which contain it, directly or through other groups. Every group
+// is contained only once, so cyclic definitions are resolved as well.
+func (g *ActionGroups) Resolve(action string) []string {
+	g.RLock()
+	defer g.RUnlock()
+
+	actions := []string{action}
+	seen := map[string]bool{action: true}
+	for i := 0; i < len(actions); i++ {
+		for _, parent := range g.parents[actions[i]] {
+			if !seen[parent] {
+				seen[parent] = true
+				actions = append(actions, parent)
+			}
+		}
+	}
+	return actions
+}
+
+// index rebuilds the parents index. The caller must hold the write lock.
+func (g *ActionGroups) index() {
+	g.parents = map[string][]string{}
+	for name, actions := range g.groups {
+		for _, action := range actions {
+			g.parents[action] = append(g.parents[action], name)
+		}
+	}
+}
+
+// resolveAction returns the action followed by all groups which contain it.
+func (l *Ladon) resolveAction(action string) []string {
+	if l.ActionGroups == nil {
+		return []string{action}
+	}
+	return l.ActionGroups.Resolve(action)
+}
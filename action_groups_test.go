@@ -0,0 +1,127 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestActionGroupsResolve(t *testing.T) {
+	groups := NewActionGroups(map[string][]string{
+		"admin": {"write", "purge"},
+		"write": {"create", "update", "delete", "patch", "read"},
+		"loop":  {"loop2"},
+		"loop2": {"loop"},
+	})
+
+	assert.Equal(t, []string{"update", "write", "admin"}, groups.Resolve("update"))
+	assert.Equal(t, []string{"purge", "admin"}, groups.Resolve("purge"))
+	assert.Equal(t, []string{"other"}, groups.Resolve("other"))
+	assert.Equal(t, []string{"loop", "loop2"}, groups.Resolve("loop"))
+
+	actions, ok := groups.Get("admin")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"write", "purge"}, actions)
+
+	groups.Delete("admin")
+	assert.Equal(t, []string{"update", "write"}, groups.Resolve("update"))
+	_, ok = groups.Get("admin")
+	assert.False(t, ok)
+
+	var empty ActionGroups
+	assert.Equal(t, []string{"read"}, empty.Resolve("read"))
+	empty.Set("write", "read")
+	assert.Equal(t, []string{"read", "write"}, empty.Resolve("read"))
+}
+
+func TestLadonActionGroups(t *testing.T) {
+	ctx := context.Background()
+	groups := NewActionGroups(map[string][]string{
+		"admin": {"write"},
+		"write": {"create", "update", "delete", "read"},
+	})
+	warden := &Ladon{Manager: NewMemoryManager(), ActionGroups: groups}
+
+	for _, p := range []Policy{
+		&DefaultPolicy{
+			ID:        "editors-write",
+			Subjects:  []string{"editor"},
+			Actions:   []string{"write"},
+			Resources: []string{"articles:<.*>"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:        "admins",
+			Subjects:  []string{"admin"},
+			Actions:   []string{"admin"},
+			Resources: []string{"<.*>"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:         "no-locked-writes",
+			Subjects:   []string{"<.*>"},
+			Actions:    []string{"<.*>"},
+			NotActions: []string{"read"},
+			Resources:  []string{"articles:locked"},
+			Effect:     DenyAccess,
+		},
+	} {
+		require.NoError(t, warden.Manager.Create(ctx, p))
+	}
+
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "editor", Action: "update", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "editor", Action: "write", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "editor", Action: "purge", Resource: "articles:1"}},
+		{r: &Request{Subject: "editor", Action: "update", Resource: "users:1"}},
+		{r: &Request{Subject: "admin", Action: "read", Resource: "users:1"}, allowed: true},
+		{r: &Request{Subject: "admin", Action: "read", Resource: "articles:locked"}, allowed: true},
+		{r: &Request{Subject: "admin", Action: "update", Resource: "articles:locked"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(ctx, c.r) == nil)
+		})
+	}
+
+	actions, err := warden.AllowedActions(ctx, "editor", "articles:1", []string{"create", "read", "purge"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"create", "read"}, actions)
+
+	groups.Set("write", "create", "update", "delete", "read", "purge")
+	assert.NoError(t, warden.IsAllowed(ctx, &Request{Subject: "editor", Action: "purge", Resource: "articles:1"}))
+
+	d, err := warden.Explain(ctx, &Request{Subject: "admin", Action: "delete", Resource: "users:1"})
+	require.NoError(t, err)
+	require.Len(t, d.Evaluations, 1)
+	assert.Equal(t, "admins", d.Evaluations[0].PolicyID)
+	assert.Equal(t, "admin", d.Evaluations[0].MatchedAction)
+}
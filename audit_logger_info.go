@@ -56,6 +56,28 @@ func (a *AuditLoggerInfo) LogGrantedAccessRequest(ctx context.Context, r *Reques
 	a.logger().Printf("policies %s allow access", joinPoliciesNames(d))
 }
 
+// LogRejectedAccessRequestByAlgorithm logs like LogRejectedAccessRequest but mentions the combining algorithm
+// if it is not the default one.
+func (a *AuditLoggerInfo) LogRejectedAccessRequestByAlgorithm(ctx context.Context, r *Request, p Policies, d Policies, algorithm string) {
+	if algorithm == DefaultCombiningAlgorithm.GetName() {
+		a.LogRejectedAccessRequest(ctx, r, p, d)
+	} else if len(d) == 0 {
+		a.logger().Printf("no policy allowed access using combining algorithm %s", algorithm)
+	} else {
+		a.logger().Printf("combining algorithm %s denied access based on policies %s", algorithm, joinPoliciesNames(d))
+	}
+}
+
+// LogGrantedAccessRequestByAlgorithm logs like LogGrantedAccessRequest but mentions the combining algorithm
+// if it is not the default one.
+func (a *AuditLoggerInfo) LogGrantedAccessRequestByAlgorithm(ctx context.Context, r *Request, p Policies, d Policies, algorithm string) {
+	if algorithm == DefaultCombiningAlgorithm.GetName() {
+		a.LogGrantedAccessRequest(ctx, r, p, d)
+	} else {
+		a.logger().Printf("combining algorithm %s granted access based on policies %s", algorithm, joinPoliciesNames(d))
+	}
+}
+
 func joinPoliciesNames(policies Policies) string {
 	names := []string{}
 	for _, policy := range policies {
@@ -96,3 +96,45 @@ func TestAuditLogger(t *testing.T) {
 	assert.Nil(t, warden.IsAllowed(ctx, r))
 	assert.Equal(t, "policies yes-deletes allow access\n", output.String())
 }
+
+func TestAuditLoggerCombiningAlgorithm(t *testing.T) {
+	var output bytes.Buffer
+
+	warden := &Ladon{
+		Manager: NewMemoryManager(),
+		AuditLogger: &AuditLoggerInfo{
+			Logger: log.New(&output, "", 0),
+		},
+		CombiningAlgorithm: &PermitOverridesAlgorithm{},
+	}
+
+	ctx := context.Background()
+
+	warden.Manager.Create(ctx, &DefaultPolicy{
+		ID:        "yes-deletes",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"delete"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	})
+	warden.Manager.Create(ctx, &DefaultPolicy{
+		ID:        "no-bob",
+		Subjects:  []string{"bob"},
+		Actions:   []string{"<delete|update>"},
+		Resources: []string{"<.*>"},
+		Effect:    DenyAccess,
+	})
+
+	assert.NotNil(t, warden.IsAllowed(ctx, &Request{}))
+	assert.Equal(t, "no policy allowed access using combining algorithm permit-overrides\n", output.String())
+
+	output.Reset()
+
+	assert.NotNil(t, warden.IsAllowed(ctx, &Request{Subject: "bob", Action: "update"}))
+	assert.Equal(t, "combining algorithm permit-overrides denied access based on policies no-bob\n", output.String())
+
+	output.Reset()
+
+	assert.Nil(t, warden.IsAllowed(ctx, &Request{Subject: "bob", Action: "delete"}))
+	assert.Equal(t, "combining algorithm permit-overrides granted access based on policies yes-deletes\n", output.String())
+}
@@ -83,19 +83,14 @@ func BenchmarkLadon(b *testing.B) {
 			})
 		})
 
-		b.Run(fmt.Sprintf("store=mysql/policies=%d", num), func(b *testing.B) {
-			benchmarkLadon(num, b, &ladon.Ladon{
-				Manager: managers["mysql"],
-				Matcher: ladon.NewRegexpMatcher(4096),
-			})
-		})
-
-		b.Run(fmt.Sprintf("store=postgres/policies=%d", num), func(b *testing.B) {
-			benchmarkLadon(num, b, &ladon.Ladon{
-				Manager: managers["postgres"],
-				Matcher: ladon.NewRegexpMatcher(4096),
+		for _, store := range []string{"sqlite", "bolt"} {
+			b.Run(fmt.Sprintf("store=%s/policies=%d", store, num), func(b *testing.B) {
+				benchmarkLadon(num, b, &ladon.Ladon{
+					Manager: managers[store](b),
+					Matcher: ladon.NewRegexpMatcher(4096),
+				})
 			})
-		})
+		}
 	}
 }
 
@@ -113,3 +108,43 @@ func generatePolicies(n int) map[string]ladon.Policy {
 	}
 	return policies
 }
+
+func BenchmarkLadonParallelEvaluation(b *testing.B) {
+	ctx := context.Background()
+	r := &ladon.Request{Subject: "users:5", Action: "bar", Resource: "baz"}
+
+	for _, num := range []int{100, 1000, 10000} {
+		policies := generateRegexpPolicies(num)
+		for _, concurrency := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("policies=%d/concurrency=%d", num, concurrency), func(b *testing.B) {
+				warden := &ladon.Ladon{
+					Matcher:               ladon.NewRegexpMatcher(4096),
+					EvaluationConcurrency: concurrency,
+				}
+
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					if err := warden.DoPoliciesAllow(ctx, r, policies); errors.Cause(err) != ladon.ErrRequestDenied {
+						b.Fatalf("Expected request to be denied but got: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// generateRegexpPolicies returns n policies which match the action and subject of the benchmark request but not its
+// resource, so that every policy has to be evaluated completely.
+func generateRegexpPolicies(n int) ladon.Policies {
+	policies := make(ladon.Policies, n)
+	for i := range policies {
+		policies[i] = &ladon.DefaultPolicy{
+			ID:        strconv.Itoa(i),
+			Subjects:  []string{fmt.Sprintf("<users:[0-9]+|groups:%d>", i%100)},
+			Actions:   []string{"<ba[rz]>"},
+			Resources: []string{fmt.Sprintf("<resources:%d:.*>", i%100), fmt.Sprintf("<articles:%d:.*>", i%100)},
+			Effect:    ladon.AllowAccess,
+		}
+	}
+	return policies
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "context"
+
+// CombiningAlgorithm decides an access request by combining the effects of the policies which apply to it.
+type CombiningAlgorithm interface {
+	// GetName returns the combining algorithm's name.
+	GetName() string
+
+	// Combine decides a request given its candidate policies. applies(k) evaluates policies[k] against the request
+	// and returns true if the policy applies to it. Algorithms should stop calling applies as soon as the decision
+	// is final and must return any error returned by applies.
+	//
+	// Combine returns the policies that decided the request and nil if access is granted. Otherwise it returns
+	// ErrRequestDenied if no policy applies, ErrRequestForcefullyDenied if a policy denied the request or
+	// ErrRequestIndeterminate if the policies do not lead to a decision. If the request is denied forcefully, the
+	// last of the deciders is reported as the denying policy, or nil if there are none.
+	Combine(policies Policies, applies func(k int) (bool, error)) (deciders Policies, err error)
+}
+
+// DefaultCombiningAlgorithm is the combining algorithm used if none is set. A policy that denies access overrides
+// all policies that allow access and access is denied if no policy applies.
+var DefaultCombiningAlgorithm = &DenyOverridesAlgorithm{}
+
+// CombiningAlgorithmAuditLogger may optionally be implemented by an AuditLogger. If it is, its methods are called
+// instead of the AuditLogger methods with the name of the combining algorithm that decided the request.
+type CombiningAlgorithmAuditLogger interface {
+	LogRejectedAccessRequestByAlgorithm(ctx context.Context, request *Request, pool Policies, deciders Policies, algorithm string)
+	LogGrantedAccessRequestByAlgorithm(ctx context.Context, request *Request, pool Policies, deciders Policies, algorithm string)
+}
+
+// CombiningAlgorithmMetric may optionally be implemented by a Metric. If it is, RequestDecidedByAlgorithm
+// is called for every decided request in addition to the Metric methods.
+type CombiningAlgorithmMetric interface {
+	// RequestDecidedByAlgorithm is called with the name of the combining algorithm that decided the request.
+	RequestDecidedByAlgorithm(r Request, algorithm string, allowed bool)
+}
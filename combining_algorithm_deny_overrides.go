@@ -0,0 +1,61 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// DenyOverridesAlgorithm grants access if at least one policy allows access and no policy denies it. A policy which
+// denies access overrides all policies which allow access. This is the default combining algorithm.
+type DenyOverridesAlgorithm struct{}
+
+// Combine grants access if a policy allows and no policy denies access. If a policy denies access, the
+// deciders contain the policies which allowed access so far followed by the denying policy.
+func (a *DenyOverridesAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	var deciders = Policies{}
+	for k, p := range policies {
+		if ok, err := applies(k); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		// Is the policy's effect `deny`? If yes, this overrides all allow policies -> access denied.
+		deciders = append(deciders, p)
+		if !p.AllowAccess() {
+			return deciders, errors.WithStack(ErrRequestForcefullyDenied)
+		}
+	}
+
+	if len(deciders) == 0 {
+		return deciders, errors.WithStack(ErrRequestDenied)
+	}
+	return deciders, nil
+}
+
+// GetName returns the combining algorithm's name.
+func (a *DenyOverridesAlgorithm) GetName() string {
+	return "deny-overrides"
+}
+
+// stopsAfter returns true if p denies access because no policy after p is evaluated then.
+func (a *DenyOverridesAlgorithm) stopsAfter(p Policy) bool {
+	return !p.AllowAccess()
+}
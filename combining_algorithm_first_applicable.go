@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// FirstApplicableAlgorithm decides a request by the effect of the first policy which applies to it. Use it with
+// managers which return candidates in a meaningful order.
+type FirstApplicableAlgorithm struct{}
+
+// Combine returns the effect of the first policy which applies to the request.
+func (a *FirstApplicableAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	for k, p := range policies {
+		if ok, err := applies(k); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		if !p.AllowAccess() {
+			return Policies{p}, errors.WithStack(ErrRequestForcefullyDenied)
+		}
+		return Policies{p}, nil
+	}
+
+	return Policies{}, errors.WithStack(ErrRequestDenied)
+}
+
+// GetName returns the combining algorithm's name.
+func (a *FirstApplicableAlgorithm) GetName() string {
+	return "first-applicable"
+}
+
+// stopsAfter returns true because no policy after the first applicable one is evaluated.
+func (a *FirstApplicableAlgorithm) stopsAfter(p Policy) bool {
+	return true
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// HighestPriorityAlgorithm decides a request by the policies with the highest priority which apply to it. If several
+// policies with the same priority apply, a policy which denies access overrides the ones which allow it. This allows
+// a specific policy with a high priority to override a broad policy with a lower priority, regardless of its effect.
+type HighestPriorityAlgorithm struct{}
+
+// Combine decides the request by the applicable policies with the highest priority. Policies with a lower priority
+// than an already applicable policy are not evaluated.
+func (a *HighestPriorityAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	var deciders = Policies{}
+	var priority int
+	var denied bool
+	for k, p := range policies {
+		current := GetPolicyPriority(p)
+		if len(deciders) > 0 && (current < priority || (current == priority && denied)) {
+			continue
+		}
+
+		if ok, err := applies(k); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		if len(deciders) == 0 || current > priority {
+			deciders = Policies{}
+			priority = current
+			denied = false
+		}
+
+		deciders = append(deciders, p)
+		denied = !p.AllowAccess()
+	}
+
+	if len(deciders) == 0 {
+		return deciders, errors.WithStack(ErrRequestDenied)
+	} else if denied {
+		return deciders, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+	return deciders, nil
+}
+
+// GetName returns the combining algorithm's name.
+func (a *HighestPriorityAlgorithm) GetName() string {
+	return "highest-priority"
+}
+
+// stopsAfter returns true if p denies access because no policy after p is evaluated then.
+func (a *HighestPriorityAlgorithm) stopsAfter(p Policy) bool {
+	return !p.AllowAccess()
+}
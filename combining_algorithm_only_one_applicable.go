@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// OnlyOneApplicableAlgorithm decides a request by the effect of the only policy which applies to it. If more than
+// one policy applies, the decision is indeterminate.
+type OnlyOneApplicableAlgorithm struct{}
+
+// Combine returns the effect of the only policy which applies to the request. If more than one policy applies,
+// ErrRequestIndeterminate is returned together with all policies that apply.
+func (a *OnlyOneApplicableAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	var deciders = Policies{}
+	for k, p := range policies {
+		if ok, err := applies(k); err != nil {
+			return nil, err
+		} else if ok {
+			deciders = append(deciders, p)
+		}
+	}
+
+	switch {
+	case len(deciders) == 0:
+		return deciders, errors.WithStack(ErrRequestDenied)
+	case len(deciders) > 1:
+		return deciders, errors.WithStack(ErrRequestIndeterminate)
+	case !deciders[0].AllowAccess():
+		return deciders, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+	return deciders, nil
+}
+
+// GetName returns the combining algorithm's name.
+func (a *OnlyOneApplicableAlgorithm) GetName() string {
+	return "only-one-applicable"
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// PermitOverridesAlgorithm grants access if at least one policy allows access, even if other policies deny it.
+type PermitOverridesAlgorithm struct{}
+
+// Combine grants access as soon as a policy allows access. If no policy allows access but a policy denies it, the
+// request is forcefully denied by the first denying policy.
+func (a *PermitOverridesAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	var denied Policy
+	for k, p := range policies {
+		if ok, err := applies(k); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		if p.AllowAccess() {
+			return Policies{p}, nil
+		} else if denied == nil {
+			denied = p
+		}
+	}
+
+	if denied != nil {
+		return Policies{denied}, errors.WithStack(ErrRequestForcefullyDenied)
+	}
+	return Policies{}, errors.WithStack(ErrRequestDenied)
+}
+
+// GetName returns the combining algorithm's name.
+func (a *PermitOverridesAlgorithm) GetName() string {
+	return "permit-overrides"
+}
+
+// stopsAfter returns true if p allows access because no policy after p is evaluated then.
+func (a *PermitOverridesAlgorithm) stopsAfter(p Policy) bool {
+	return p.AllowAccess()
+}
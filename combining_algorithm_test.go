@@ -0,0 +1,162 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+type algorithmMetric struct {
+	MetricNoOp
+	sync.Mutex
+	decisions []string
+}
+
+func (m *algorithmMetric) RequestDecidedByAlgorithm(r Request, algorithm string, allowed bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.decisions = append(m.decisions, fmt.Sprintf("%s:%t", algorithm, allowed))
+}
+
+func TestCombiningAlgorithms(t *testing.T) {
+	allowArticles := &DefaultPolicy{
+		ID:        "allow-articles",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"<view|update>"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    AllowAccess,
+	}
+	denyUpdates := &DefaultPolicy{
+		ID:        "deny-updates",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"update"},
+		Resources: []string{"<.*>"},
+		Effect:    DenyAccess,
+	}
+	allowAll := &DefaultPolicy{
+		ID:        "allow-all",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"<.*>"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	}
+	policies := Policies{allowArticles, denyUpdates, allowAll}
+
+	view := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+	update := &Request{Subject: "peter", Action: "update", Resource: "articles:1"}
+	deleteOther := &Request{Subject: "ken", Action: "delete", Resource: "printers:1"}
+	updateOther := &Request{Subject: "ken", Action: "update", Resource: "printers:1"}
+
+	for _, c := range []struct {
+		algorithm CombiningAlgorithm
+		policies  Policies
+		r         *Request
+		expectErr error
+		deciders  []string
+		evaluated int
+	}{
+		{algorithm: &DenyOverridesAlgorithm{}, policies: policies, r: view, deciders: []string{"allow-articles", "allow-all"}, evaluated: 3},
+		{algorithm: &DenyOverridesAlgorithm{}, policies: policies, r: update, expectErr: ErrRequestForcefullyDenied, deciders: []string{"allow-articles", "deny-updates"}, evaluated: 2},
+		{algorithm: &DenyOverridesAlgorithm{}, policies: policies[:2], r: deleteOther, expectErr: ErrRequestDenied, deciders: []string{}, evaluated: 2},
+
+		{algorithm: &PermitOverridesAlgorithm{}, policies: policies, r: update, deciders: []string{"allow-articles"}, evaluated: 1},
+		{algorithm: &PermitOverridesAlgorithm{}, policies: Policies{denyUpdates, allowAll}, r: updateOther, deciders: []string{"allow-all"}, evaluated: 2},
+		{algorithm: &PermitOverridesAlgorithm{}, policies: policies[:2], r: updateOther, expectErr: ErrRequestForcefullyDenied, deciders: []string{"deny-updates"}, evaluated: 2},
+		{algorithm: &PermitOverridesAlgorithm{}, policies: policies[:2], r: deleteOther, expectErr: ErrRequestDenied, deciders: []string{}, evaluated: 2},
+
+		{algorithm: &FirstApplicableAlgorithm{}, policies: policies, r: update, deciders: []string{"allow-articles"}, evaluated: 1},
+		{algorithm: &FirstApplicableAlgorithm{}, policies: Policies{denyUpdates, allowAll}, r: updateOther, expectErr: ErrRequestForcefullyDenied, deciders: []string{"deny-updates"}, evaluated: 1},
+		{algorithm: &FirstApplicableAlgorithm{}, policies: policies, r: deleteOther, deciders: []string{"allow-all"}, evaluated: 3},
+		{algorithm: &FirstApplicableAlgorithm{}, policies: policies[:2], r: deleteOther, expectErr: ErrRequestDenied, deciders: []string{}, evaluated: 2},
+
+		{algorithm: &OnlyOneApplicableAlgorithm{}, policies: policies, r: deleteOther, deciders: []string{"allow-all"}, evaluated: 3},
+		{algorithm: &OnlyOneApplicableAlgorithm{}, policies: policies[:2], r: updateOther, expectErr: ErrRequestForcefullyDenied, deciders: []string{"deny-updates"}, evaluated: 2},
+		{algorithm: &OnlyOneApplicableAlgorithm{}, policies: policies, r: view, expectErr: ErrRequestIndeterminate, deciders: []string{"allow-articles", "allow-all"}, evaluated: 3},
+		{algorithm: &OnlyOneApplicableAlgorithm{}, policies: policies[:2], r: deleteOther, expectErr: ErrRequestDenied, deciders: []string{}, evaluated: 2},
+	} {
+		t.Run(fmt.Sprintf("algorithm=%s/subject=%s/action=%s", c.algorithm.GetName(), c.r.Subject, c.r.Action), func(t *testing.T) {
+			metric := &algorithmMetric{}
+			warden := &Ladon{CombiningAlgorithm: c.algorithm, Metric: metric}
+
+			d, err := warden.ExplainPolicies(context.Background(), c.r, c.policies)
+			assert.Equal(t, c.expectErr, errors.Cause(err))
+			assert.Equal(t, c.algorithm.GetName(), d.Algorithm)
+			assert.Equal(t, c.deciders, d.Deciders)
+			assert.Equal(t, c.expectErr == nil, d.Allowed)
+
+			var evaluated int
+			for _, e := range d.Evaluations {
+				if e.Evaluated {
+					evaluated++
+				}
+			}
+			assert.Equal(t, c.evaluated, evaluated)
+
+			require.Len(t, metric.decisions, 1)
+			assert.Equal(t, fmt.Sprintf("%s:%t", c.algorithm.GetName(), c.expectErr == nil), metric.decisions[0])
+		})
+	}
+}
+
+func TestDefaultCombiningAlgorithm(t *testing.T) {
+	d, err := (&Ladon{}).ExplainPolicies(context.Background(), &Request{}, Policies{})
+	assert.Equal(t, ErrRequestDenied, errors.Cause(err))
+	assert.Equal(t, "deny-overrides", d.Algorithm)
+}
+
+// denyingAlgorithm denies every request forcefully without naming a policy.
+type denyingAlgorithm struct{}
+
+func (a *denyingAlgorithm) GetName() string {
+	return "deny"
+}
+
+func (a *denyingAlgorithm) Combine(policies Policies, applies func(k int) (bool, error)) (Policies, error) {
+	return nil, errors.WithStack(ErrRequestForcefullyDenied)
+}
+
+type deniedByMetric struct {
+	MetricNoOp
+	deniedBy chan Policy
+}
+
+func (m *deniedByMetric) RequestDeniedBy(r Request, p Policy) {
+	m.deniedBy <- p
+}
+
+func TestCombiningAlgorithmWithoutDeciders(t *testing.T) {
+	metric := &deniedByMetric{deniedBy: make(chan Policy, 1)}
+	warden := &Ladon{CombiningAlgorithm: &denyingAlgorithm{}, Metric: metric}
+
+	d, err := warden.ExplainPolicies(context.Background(), &Request{}, Policies{&DefaultPolicy{ID: "1"}})
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+	assert.Equal(t, []string{}, d.Deciders)
+	assert.Nil(t, <-metric.deniedBy)
+}
@@ -68,12 +68,15 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/dlclark/regexp2"
 )
 
-const regexp2MatchTimeout = time.Millisecond * 250
+// DefaultMatchTimeout is the maximum duration a single match of a regular expression compiled by CompileRegex may
+// take.
+const DefaultMatchTimeout = time.Millisecond * 250
 
 // delimiterIndices returns the first level delimiter indices from a string.
 // It returns an error in case of unbalanced delimiters.
@@ -111,6 +114,11 @@ func delimiterIndices(s string, delimiterStart, delimiterEnd byte) ([]int, error
 //  // if err != nil ...
 //  reg.MatchString("foo:bar.baz:123")
 func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regexp, error) {
+	return CompileRegexWithTimeout(tpl, delimiterStart, delimiterEnd, DefaultMatchTimeout)
+}
+
+// CompileRegexWithTimeout works like CompileRegex but a single match of the returned Regexp may take at most timeout.
+func CompileRegexWithTimeout(tpl string, delimiterStart, delimiterEnd byte, timeout time.Duration) (*regexp2.Regexp, error) {
 	// Check if it is well-formed.
 	idxs, errBraces := delimiterIndices(tpl, delimiterStart, delimiterEnd)
 	if errBraces != nil {
@@ -133,7 +141,7 @@ func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regex
 		if err != nil {
 			return nil, err
 		}
-		reg.MatchTimeout = regexp2MatchTimeout
+		reg.MatchTimeout = timeout
 		varsR[varIdx] = reg
 	}
 
@@ -147,7 +155,17 @@ func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regex
 	if errCompile != nil {
 		return nil, errCompile
 	}
-	reg.MatchTimeout = regexp2MatchTimeout
+	reg.MatchTimeout = timeout
 
 	return reg, nil
 }
+
+// LiteralPrefix returns the part of a template before its first regular expression. Every string which matches the
+// template starts with this prefix. If the template does not contain a regular expression, the template itself is
+// returned.
+func LiteralPrefix(tpl string, delimiterStart byte) string {
+	if i := strings.IndexByte(tpl, delimiterStart); i >= 0 {
+		return tpl[:i]
+	}
+	return tpl
+}
@@ -22,6 +22,7 @@ package compiler
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dlclark/regexp2"
 	"github.com/stretchr/testify/assert"
@@ -73,3 +74,28 @@ func TestRegexCompiler(t *testing.T) {
 
 	}
 }
+
+func TestRegexCompilerTimeout(t *testing.T) {
+	reg, err := CompileRegex("urn:foo:<.*>", '<', '>')
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMatchTimeout, reg.MatchTimeout)
+
+	reg, err = CompileRegexWithTimeout("urn:foo:<.*>", '<', '>', time.Millisecond*10)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Millisecond*10, reg.MatchTimeout)
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	for _, c := range []struct {
+		template string
+		prefix   string
+	}{
+		{"urn:foo:<.*>", "urn:foo:"},
+		{"urn:foo:<.*>:bar:<.*>", "urn:foo:"},
+		{"<.*>", ""},
+		{"urn:foo", "urn:foo"},
+		{"", ""},
+	} {
+		assert.Equal(t, c.prefix, LiteralPrefix(c.template, '<'), "%s", c.template)
+	}
+}
@@ -29,11 +29,12 @@ type StringEqualCondition struct {
 }
 
 // Fulfills returns true if the given value is a string and is the
-// same as in StringEqualCondition.Equals
-func (c *StringEqualCondition) Fulfills(ctx context.Context, value interface{}, _ *Request) bool {
+// same as in StringEqualCondition.Equals. Policy variables in StringEqualCondition.Equals are resolved first.
+func (c *StringEqualCondition) Fulfills(ctx context.Context, value interface{}, r *Request) bool {
 	s, ok := value.(string)
+	equals, resolved := ResolveVariables(c.Equals, r, nil)
 
-	return ok && s == c.Equals
+	return ok && resolved && s == equals
 }
 
 // GetName returns the condition's name.
@@ -32,11 +32,16 @@ type StringMatchCondition struct {
 }
 
 // Fulfills returns true if the given value is a string and matches the regex
-// pattern in StringMatchCondition.Matches
-func (c *StringMatchCondition) Fulfills(ctx context.Context, value interface{}, _ *Request) bool {
+// pattern in StringMatchCondition.Matches. Policy variables in the pattern are resolved and escaped first.
+func (c *StringMatchCondition) Fulfills(ctx context.Context, value interface{}, r *Request) bool {
 	s, ok := value.(string)
 
-	matches, _ := regexp.MatchString(c.Matches, s)
+	pattern, resolved := ResolveVariables(c.Matches, r, regexp.QuoteMeta)
+	if !resolved {
+		return false
+	}
+
+	matches, _ := regexp.MatchString(pattern, s)
 
 	return ok && matches
 }
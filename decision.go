@@ -0,0 +1,132 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// Decision explains how the warden came to a decision for an access request.
+type Decision struct {
+	// Request is the access request that was evaluated.
+	Request *Request `json:"request"`
+
+	// Allowed is true if the request was granted.
+	Allowed bool `json:"allowed"`
+
+	// Effect is the final effect of the decision. It is Indeterminate if the request could not be decided.
+	Effect Effect `json:"effect"`
+
+	// Algorithm is the name of the combining algorithm that decided the request.
+	Algorithm string `json:"algorithm"`
+
+	// Deciders contains the IDs of the policies that decided the request. If the request was forcefully denied,
+	// the last entry is the policy that denied it. If no policy matched, this is empty.
+	Deciders []string `json:"deciders"`
+
+	// Obligations contains the merged obligations of the deciding policies whose effect equals the decision. If
+	// several policies define an obligation with the same key, the one of the policy evaluated first is used.
+	Obligations Obligations `json:"obligations,omitempty"`
+
+	// Advice contains the merged advice of the deciding policies, see Obligations.
+	Advice Obligations `json:"advice,omitempty"`
+
+	// Evaluations contains one entry per candidate policy, in the order the policies were evaluated.
+	Evaluations []PolicyEvaluation `json:"evaluations"`
+}
+
+// PolicyEvaluation describes how a single policy was evaluated against an access request.
+//
+// Checks are performed in the order actions, subjects, resources and conditions and evaluation of a policy
+// stops at the first check that does not match. Checks that were not reached are therefore false.
+type PolicyEvaluation struct {
+	// PolicyID is the ID of the evaluated policy.
+	PolicyID string `json:"policy_id"`
+
+	// Policy is the evaluated policy.
+	Policy Policy `json:"-"`
+
+	// Evaluated is false if the policy was not evaluated because the combining algorithm reached a decision
+	// before.
+	Evaluated bool `json:"evaluated"`
+
+	// ActionMatched is true if the request's action or one of the groups containing it matched one of the policy's
+	// actions and none of them matched one of its excluded actions.
+	ActionMatched bool `json:"action_matched"`
+
+	// MatchedAction is the action or action group which matched the policy's actions.
+	MatchedAction string `json:"matched_action,omitempty"`
+
+	// SubjectMatched is true if the request's subject or one of its roles and groups matched one of the policy's
+	// subjects and none of them matched one of its excluded subjects.
+	SubjectMatched bool `json:"subject_matched"`
+
+	// MatchedSubject is the subject, role or group which matched the policy's subjects.
+	MatchedSubject string `json:"matched_subject,omitempty"`
+
+	// ResourceMatched is true if the request's resource or one of its ancestors matched one of the policy's
+	// resources and none of them matched one of its excluded resources.
+	ResourceMatched bool `json:"resource_matched"`
+
+	// MatchedResource is the resource or ancestor resource which matched the policy's resources.
+	MatchedResource string `json:"matched_resource,omitempty"`
+
+	// ConditionsPassed is true if all of the policy's conditions were fulfilled.
+	ConditionsPassed bool `json:"conditions_passed"`
+
+	// FailedCondition is the key of the condition that was not fulfilled, if any.
+	FailedCondition string `json:"failed_condition,omitempty"`
+
+	// FailedConditionValue is the request's context value the failed condition was evaluated against.
+	FailedConditionValue interface{} `json:"failed_condition_value,omitempty"`
+}
+
+// Applies returns true if the policy matched the request and all of its conditions were fulfilled.
+func (e *PolicyEvaluation) Applies() bool {
+	return e.ActionMatched && e.SubjectMatched && e.ResourceMatched && e.ConditionsPassed
+}
+
+// evaluate prepares the decision for the evaluation of the given policies using algorithm. Every policy is
+// recorded as not evaluated until its evaluation is recorded. It is safe to call evaluate on a nil Decision.
+func (d *Decision) evaluate(algorithm CombiningAlgorithm, policies Policies) {
+	if d == nil {
+		return
+	}
+
+	d.Algorithm = algorithm.GetName()
+	d.Evaluations = make([]PolicyEvaluation, len(policies))
+	for k, p := range policies {
+		d.Evaluations[k] = PolicyEvaluation{PolicyID: p.GetID(), Policy: p}
+	}
+}
+
+// decide records the outcome of the evaluation. It is safe to call decide on a nil Decision.
+func (d *Decision) decide(effect Effect, deciders Policies) {
+	if d == nil {
+		return
+	}
+
+	d.Allowed = effect == Permit
+	d.Effect = effect
+
+	d.Deciders = make([]string, len(deciders))
+	for k, p := range deciders {
+		d.Deciders[k] = p.GetID()
+	}
+
+	d.Obligations, d.Advice = obligationsOf(effect, deciders)
+}
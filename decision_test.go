@@ -0,0 +1,174 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestLadonExplain(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.NoError(t, warden.Manager.Create(ctx, pol))
+	}
+
+	for k, c := range cases {
+		t.Run(fmt.Sprintf("case=%d-%s", k, c.description), func(t *testing.T) {
+			d, err := warden.Explain(ctx, c.accessRequest)
+			require.NotNil(t, d)
+			assert.Equal(t, warden.IsAllowed(ctx, c.accessRequest) == nil, err == nil)
+			assert.Equal(t, err == nil, d.Allowed)
+
+			candidates, findErr := warden.Manager.FindRequestCandidates(ctx, c.accessRequest)
+			require.NoError(t, findErr)
+			assert.Len(t, d.Evaluations, len(candidates))
+
+			var applied []string
+			for _, e := range d.Evaluations {
+				if e.Applies() {
+					applied = append(applied, e.PolicyID)
+				}
+			}
+			assert.Equal(t, EffectOf(err), d.Effect)
+			if d.Allowed {
+				assert.Equal(t, applied, d.Deciders)
+			}
+		})
+	}
+}
+
+func TestLadonExplainPolicies(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{}
+	policies := Policies{
+		&DefaultPolicy{
+			ID:        "allow-articles",
+			Subjects:  []string{"peter"},
+			Actions:   []string{"view"},
+			Resources: []string{"articles:<[0-9]+>"},
+			Effect:    AllowAccess,
+			Conditions: Conditions{
+				"owner": &EqualsSubjectCondition{},
+			},
+		},
+		&DefaultPolicy{
+			ID:        "wrong-action",
+			Subjects:  []string{"peter"},
+			Actions:   []string{"delete"},
+			Resources: []string{"<.*>"},
+			Effect:    DenyAccess,
+		},
+		&DefaultPolicy{
+			ID:        "deny-1234",
+			Subjects:  []string{"<.*>"},
+			Actions:   []string{"view"},
+			Resources: []string{"articles:1234"},
+			Effect:    DenyAccess,
+		},
+		&DefaultPolicy{
+			ID:        "never-evaluated",
+			Subjects:  []string{"<.*>"},
+			Actions:   []string{"<.*>"},
+			Resources: []string{"<.*>"},
+			Effect:    AllowAccess,
+		},
+	}
+
+	t.Run("case=failed condition", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{
+			Subject:  "peter",
+			Action:   "view",
+			Resource: "articles:1",
+			Context:  Context{"owner": "ken"},
+		}, policies[:2])
+		assert.Equal(t, ErrRequestDenied, errors.Cause(err))
+		assert.False(t, d.Allowed)
+		assert.Equal(t, NotApplicable, d.Effect)
+		assert.Empty(t, d.Deciders)
+		require.Len(t, d.Evaluations, 2)
+
+		assert.Equal(t, PolicyEvaluation{
+			PolicyID:             "allow-articles",
+			Policy:               policies[0],
+			Evaluated:            true,
+			ActionMatched:        true,
+			MatchedAction:        "view",
+			SubjectMatched:       true,
+			MatchedSubject:       "peter",
+			ResourceMatched:      true,
+			MatchedResource:      "articles:1",
+			FailedCondition:      "owner",
+			FailedConditionValue: "ken",
+		}, d.Evaluations[0])
+		assert.Equal(t, PolicyEvaluation{
+			PolicyID:  "wrong-action",
+			Policy:    policies[1],
+			Evaluated: true,
+		}, d.Evaluations[1])
+	})
+
+	t.Run("case=allowed", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{
+			Subject:  "peter",
+			Action:   "view",
+			Resource: "articles:1",
+			Context:  Context{"owner": "peter"},
+		}, policies[:3])
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, Permit, d.Effect)
+		assert.Equal(t, []string{"allow-articles"}, d.Deciders)
+		require.Len(t, d.Evaluations, 3)
+		assert.True(t, d.Evaluations[0].Applies())
+		assert.False(t, d.Evaluations[1].Applies())
+		assert.True(t, d.Evaluations[2].ActionMatched)
+		assert.True(t, d.Evaluations[2].SubjectMatched)
+		assert.False(t, d.Evaluations[2].ResourceMatched)
+	})
+
+	t.Run("case=forcefully denied", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{
+			Subject:  "peter",
+			Action:   "view",
+			Resource: "articles:1234",
+			Context:  Context{"owner": "peter"},
+		}, policies)
+		assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+		assert.False(t, d.Allowed)
+		assert.Equal(t, []string{"allow-articles", "deny-1234"}, d.Deciders)
+		require.Len(t, d.Evaluations, 4)
+		assert.True(t, d.Evaluations[2].Applies())
+		assert.Equal(t, PolicyEvaluation{
+			PolicyID: "never-evaluated",
+			Policy:   policies[3],
+		}, d.Evaluations[3])
+	})
+}
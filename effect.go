@@ -0,0 +1,136 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Effect is the outcome of an access decision.
+type Effect int
+
+const (
+	// Indeterminate means that no decision could be made, for example because the manager or a matcher failed or the
+	// policies which apply to the request contradict each other. It is the zero value so that it fails closed.
+	Indeterminate Effect = iota
+
+	// Permit means that access is granted.
+	Permit
+
+	// Deny means that access is explicitly denied by a policy.
+	Deny
+
+	// NotApplicable means that no policy applies to the request.
+	NotApplicable
+)
+
+var effectNames = map[Effect]string{
+	Indeterminate: "indeterminate",
+	Permit:        "permit",
+	Deny:          "deny",
+	NotApplicable: "not_applicable",
+}
+
+// String returns the name of the effect.
+func (e Effect) String() string {
+	if name, ok := effectNames[e]; ok {
+		return name
+	}
+	return effectNames[Indeterminate]
+}
+
+// MarshalJSON marshals the effect to its name.
+func (e Effect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+// UnmarshalJSON unmarshals the effect from its name.
+func (e *Effect) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for effect, n := range effectNames {
+		if n == name {
+			*e = effect
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown effect %s", name)
+}
+
+// EffectOf returns the effect corresponding to an error returned by Warden.IsAllowed.
+func EffectOf(err error) Effect {
+	switch errors.Cause(err) {
+	case nil:
+		return Permit
+	case ErrRequestForcefullyDenied:
+		return Deny
+	case ErrRequestDenied:
+		return NotApplicable
+	}
+	return Indeterminate
+}
+
+// Err returns the error Warden.IsAllowed returns for the effect, or nil if the effect is Permit.
+func (e Effect) Err() error {
+	switch e {
+	case Permit:
+		return nil
+	case Deny:
+		return errors.WithStack(ErrRequestForcefullyDenied)
+	case NotApplicable:
+		return errors.WithStack(ErrRequestDenied)
+	}
+	return errors.WithStack(ErrRequestIndeterminate)
+}
+
+// Evaluator decides access requests with one of the effects Permit, Deny, NotApplicable or Indeterminate.
+type Evaluator interface {
+	// Evaluate returns the effect of the access request. If the effect is Indeterminate, the returned error
+	// describes why no decision could be made. Otherwise, the error is nil.
+	Evaluate(ctx context.Context, r *Request) (Effect, error)
+}
+
+// Evaluate decides the request like IsAllowed but returns the effect of the decision. Unlike IsAllowed, it
+// distinguishes requests to which no policy applies (NotApplicable) from requests which are explicitly denied (Deny)
+// and requests which can not be decided because of an error (Indeterminate).
+func (l *Ladon) Evaluate(ctx context.Context, r *Request) (Effect, error) {
+	return effectOf(l.IsAllowed(ctx, r))
+}
+
+// EvaluatePolicies works like Evaluate but decides the request with the given policies, see DoPoliciesAllow.
+func (l *Ladon) EvaluatePolicies(ctx context.Context, r *Request, policies []Policy) (Effect, error) {
+	return effectOf(l.DoPoliciesAllow(ctx, r, policies))
+}
+
+// effectOf returns the effect of err and err itself if the effect is Indeterminate.
+func effectOf(err error) (Effect, error) {
+	effect := EffectOf(err)
+	if effect != Indeterminate {
+		return effect, nil
+	}
+	return effect, err
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type staticEvaluator struct {
+	effect Effect
+	err    error
+}
+
+func (e staticEvaluator) Evaluate(_ context.Context, _ *Request) (Effect, error) {
+	return e.effect, e.err
+}
+
+func TestEffectOf(t *testing.T) {
+	assert.Equal(t, Permit, EffectOf(nil))
+	assert.Equal(t, Deny, EffectOf(errors.WithStack(ErrRequestForcefullyDenied)))
+	assert.Equal(t, NotApplicable, EffectOf(errors.WithStack(ErrRequestDenied)))
+	assert.Equal(t, Indeterminate, EffectOf(errors.WithStack(ErrRequestIndeterminate)))
+	assert.Equal(t, Indeterminate, EffectOf(errors.New("matcher failed")))
+
+	for _, effect := range []Effect{Permit, Deny, NotApplicable, Indeterminate} {
+		assert.Equal(t, effect, EffectOf(effect.Err()), "%s", effect)
+	}
+}
+
+func TestEffectJSON(t *testing.T) {
+	for _, effect := range []Effect{Permit, Deny, NotApplicable, Indeterminate} {
+		out, err := json.Marshal(effect)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("%q", effect), string(out))
+
+		var in Effect
+		require.NoError(t, json.Unmarshal(out, &in))
+		assert.Equal(t, effect, in)
+	}
+
+	var e Effect
+	assert.Error(t, json.Unmarshal([]byte(`"maybe"`), &e))
+}
+
+func TestLadonEvaluate(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.NoError(t, warden.Manager.Create(ctx, pol))
+	}
+
+	for k, c := range []struct {
+		r      *Request
+		effect Effect
+	}{
+		{
+			r:      &Request{Subject: "peter", Action: "delete", Resource: "myrn:some.domain.com:resource:123", Context: Context{"owner": "peter", "clientIP": "127.0.0.1"}},
+			effect: Permit,
+		},
+		{
+			r:      &Request{Subject: "max", Action: "broadcast", Resource: "myrn:some.domain.com:resource:123"},
+			effect: Deny,
+		},
+		{
+			r:      &Request{Subject: "ken", Action: "delete", Resource: "myrn:some.domain.com:resource:123"},
+			effect: NotApplicable,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			effect, err := warden.Evaluate(ctx, c.r)
+			require.NoError(t, err)
+			assert.Equal(t, c.effect, effect)
+		})
+	}
+
+	effect, err := warden.EvaluatePolicies(ctx, &Request{Subject: "peter", Action: "delete", Resource: "myrn:some.domain.com:resource:123"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, NotApplicable, effect)
+}
+
+func TestLadonEvaluateIndeterminate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockManager(ctrl)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	warden := &Ladon{Manager: m}
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+	m.EXPECT().FindRequestCandidates(ctx, r).Return(nil, errors.New("lookup failed"))
+
+	effect, err := warden.Evaluate(ctx, r)
+	assert.Equal(t, Indeterminate, effect)
+	assert.EqualError(t, err, "lookup failed")
+
+	warden = &Ladon{CombiningAlgorithm: &OnlyOneApplicableAlgorithm{}}
+	effect, err = warden.EvaluatePolicies(ctx, r, Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess},
+		&DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess},
+	})
+	assert.Equal(t, Indeterminate, effect)
+	assert.Equal(t, ErrRequestIndeterminate, errors.Cause(err))
+}
+
+func TestWardenChain(t *testing.T) {
+	ctx := context.Background()
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+	for k, c := range []struct {
+		chain  WardenChain
+		effect Effect
+		err    error
+	}{
+		{chain: WardenChain{}, effect: NotApplicable, err: ErrRequestDenied},
+		{chain: WardenChain{staticEvaluator{effect: NotApplicable}, staticEvaluator{effect: Permit}}, effect: Permit},
+		{chain: WardenChain{staticEvaluator{effect: NotApplicable}, staticEvaluator{effect: Deny}, staticEvaluator{effect: Permit}}, effect: Deny, err: ErrRequestForcefullyDenied},
+		{chain: WardenChain{staticEvaluator{effect: NotApplicable}, staticEvaluator{effect: NotApplicable}}, effect: NotApplicable, err: ErrRequestDenied},
+		{chain: WardenChain{staticEvaluator{effect: Indeterminate}, staticEvaluator{effect: Permit}}, effect: Indeterminate, err: ErrRequestIndeterminate},
+		{chain: WardenChain{staticEvaluator{effect: Indeterminate, err: errors.New("backend down")}, staticEvaluator{effect: Permit}}, effect: Indeterminate},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			effect, err := c.chain.Evaluate(ctx, r)
+			assert.Equal(t, c.effect, effect)
+			if c.effect != Indeterminate {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			err = c.chain.IsAllowed(ctx, r)
+			if c.effect == Permit {
+				assert.NoError(t, err)
+			} else if c.err != nil {
+				assert.Equal(t, c.err, errors.Cause(err))
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
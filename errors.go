@@ -43,6 +43,23 @@ var (
 		reason: "The request was denied because a policy denied request.",
 	}
 
+	// ErrRequestIndeterminate is returned when the policies which apply to an access request do not lead to a decision.
+	ErrRequestIndeterminate = &errorWithContext{
+		error:  errors.New("Request was denied because the decision is indeterminate"),
+		code:   http.StatusForbidden,
+		status: http.StatusText(http.StatusForbidden),
+		reason: "The request was denied because the policies which apply to it do not lead to a decision.",
+	}
+
+	// ErrRequestCanceled is returned when the context of an access request is canceled or its deadline is exceeded
+	// before a decision was made.
+	ErrRequestCanceled = &errorWithContext{
+		error:  errors.New("Request was canceled before a decision was made"),
+		code:   http.StatusRequestTimeout,
+		status: http.StatusText(http.StatusRequestTimeout),
+		reason: "The request was denied because it was canceled or timed out before a decision was made.",
+	}
+
 	// ErrNotFound is returned when a resource can not be found.
 	ErrNotFound = &errorWithContext{
 		error:  errors.New("Resource could not be found"),
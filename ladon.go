@@ -22,6 +22,7 @@ package ladon
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -32,6 +33,47 @@ type Ladon struct {
 	Matcher     matcher
 	AuditLogger AuditLogger
 	Metric      Metric
+
+	// CombiningAlgorithm combines the effects of the policies which apply to a request. Defaults to
+	// DefaultCombiningAlgorithm.
+	CombiningAlgorithm CombiningAlgorithm
+
+	// SubjectResolver resolves the roles and groups of a request's subject. If set, a policy matches a request if it
+	// matches the subject or any of the roles and groups it transitively belongs to.
+	SubjectResolver SubjectResolver
+
+	// ResourceSeparator enables resource hierarchies if it is not empty. Resources then inherit the policies of their
+	// ancestors, which are derived by cutting off the resource at the separator. With separator ":", a policy for
+	// "projects:42" applies to "projects:42:documents:7" as well.
+	ResourceSeparator string
+
+	// ActionGroups defines named groups of actions. If set, a policy matches a request if it matches the action or
+	// any of the groups which contain the action.
+	ActionGroups *ActionGroups
+
+	// ShadowManager enables shadow mode if set. Every request decided by IsAllowed or Explain is then evaluated
+	// against the policies of ShadowManager as well. The live decision is always enforced. If the shadow decision has
+	// a different effect, the divergence is reported to the AuditLogger and Metric if they implement
+	// ShadowAuditLogger or ShadowMetric. The shadow evaluation runs in the background once the live decision has been
+	// made, so divergences are reported asynchronously and never delay the live decision.
+	ShadowManager Manager
+
+	// ShadowPolicies works like ShadowManager but evaluates the given policies instead. It takes precedence over
+	// ShadowManager.
+	ShadowPolicies Policies
+
+	// ShadowTimeout bounds the duration of a shadow evaluation. The shadow evaluation is detached from the caller's
+	// context, so it is not canceled when the live request returns. Defaults to DefaultShadowTimeout.
+	ShadowTimeout time.Duration
+
+	// EvaluationConcurrency is the maximum number of goroutines which evaluate the candidate policies of a request
+	// in parallel. If it is smaller than 2, or if there are only a few candidates, policies are evaluated
+	// sequentially. The decision is the same either way.
+	EvaluationConcurrency int
+
+	// BatchConcurrency is the maximum number of requests IsAllowedBatch evaluates in parallel. If it is smaller
+	// than 2, requests are evaluated sequentially.
+	BatchConcurrency int
 }
 
 func (l *Ladon) matcher() matcher {
@@ -48,104 +90,290 @@ func (l *Ladon) auditLogger() AuditLogger {
 	return DefaultAuditLogger
 }
 
+func (l *Ladon) combiningAlgorithm() CombiningAlgorithm {
+	if l.CombiningAlgorithm != nil {
+		return l.CombiningAlgorithm
+	}
+	return DefaultCombiningAlgorithm
+}
+
 func (l *Ladon) metric() Metric {
-	if l.Metric == nil {
-		l.Metric = DefaultMetric
+	if l.Metric != nil {
+		return l.Metric
 	}
-	return l.Metric
+	return DefaultMetric
 }
 
 // IsAllowed returns nil if subject s has permission p on resource r with context c or an error otherwise.
 func (l *Ladon) IsAllowed(ctx context.Context, r *Request) (err error) {
-	policies, err := l.Manager.FindRequestCandidates(ctx, r)
+	_, err = l.isAllowed(ctx, r, nil)
+	return err
+}
+
+// Explain works like IsAllowed but additionally returns a Decision which describes how each candidate policy
+// was evaluated and which policies decided the request. The returned error is the same IsAllowed would return.
+func (l *Ladon) Explain(ctx context.Context, r *Request) (*Decision, error) {
+	return l.isAllowed(ctx, r, &Decision{Request: r})
+}
+
+func (l *Ladon) isAllowed(ctx context.Context, r *Request, d *Decision) (*Decision, error) {
+	if l.shadowed() {
+		if d == nil {
+			d = &Decision{Request: r}
+		}
+		defer func() { go l.shadow(ctx, r, d) }()
+	}
+
+	scope, err := l.scope(ctx, r)
 	if err != nil {
 		go l.metric().RequestProcessingError(*r, nil, err)
-		return err
+		return d, err
+	}
+
+	policies, err := l.findRequestCandidates(ctx, r, scope)
+	if err != nil {
+		go l.metric().RequestProcessingError(*r, nil, err)
+		return d, err
 	}
 
 	// Although the manager is responsible of matching the policies, it might decide to just scan for
 	// subjects, it might return all policies, or it might have a different pattern matching than Golang.
 	// Thus, we need to make sure that we actually matched the right policies.
-	return l.DoPoliciesAllow(ctx, r, policies)
+	return d, l.doPoliciesAllow(ctx, r, scope, policies, d)
 }
 
 // DoPoliciesAllow returns nil if subject s has permission p on resource r with context c for a given policy list or an error otherwise.
 // The IsAllowed interface should be preferred since it uses the manager directly. This is a lower level interface for when you don't want to use the ladon manager.
+// Policies are evaluated in the order of their priority, see PrioritizedPolicy. Policies with the same priority are
+// evaluated in the given order.
 func (l *Ladon) DoPoliciesAllow(ctx context.Context, r *Request, policies []Policy) (err error) {
-	var allowed = false
-	var deciders = Policies{}
+	_, err = l.explainPolicies(ctx, r, policies, nil)
+	return err
+}
 
-	// Iterate through all policies
-	for _, p := range policies {
+// ExplainPolicies works like DoPoliciesAllow but additionally returns a Decision, see Explain.
+func (l *Ladon) ExplainPolicies(ctx context.Context, r *Request, policies []Policy) (*Decision, error) {
+	return l.explainPolicies(ctx, r, policies, &Decision{Request: r})
+}
 
-		// Does the action match with one of the policies?
-		// This is the first check because usually actions are a superset of get|update|delete|set
-		// and thus match faster.
-		if pm, err := l.matcher().Matches(p, p.GetActions(), r.Action); err != nil {
-			go l.metric().RequestProcessingError(*r, p, err)
-			return errors.WithStack(err)
-		} else if !pm {
-			// no, continue to next policy
-			continue
+func (l *Ladon) explainPolicies(ctx context.Context, r *Request, policies []Policy, d *Decision) (*Decision, error) {
+	scope, err := l.scope(ctx, r)
+	if err != nil {
+		go l.metric().RequestProcessingError(*r, nil, err)
+		return d, err
+	}
+	return d, l.doPoliciesAllow(ctx, r, scope, policies, d)
+}
+
+// doPoliciesAllow implements DoPoliciesAllow. If d is not nil, the evaluation of every policy is recorded in it.
+func (l *Ladon) doPoliciesAllow(ctx context.Context, r *Request, scope *requestScope, policies []Policy, d *Decision) (err error) {
+	policies = sortByPriority(policies)
+	algorithm := l.combiningAlgorithm()
+	d.evaluate(algorithm, policies)
+
+	evaluate := l.policyEvaluator(ctx, r, scope, policies, algorithm)
+	deciders, err := algorithm.Combine(policies, func(k int) (bool, error) {
+		if ctx.Err() != nil {
+			// Nobody is waiting for the decision anymore, so the remaining policies are not evaluated.
+			err := errors.WithStack(ErrRequestCanceled)
+			go l.metric().RequestProcessingError(*r, nil, err)
+			return false, err
 		}
 
-		// Does the subject match with one of the policies?
-		// There are usually less subjects than resources which is why this is checked
-		// before checking for resources.
-		if sm, err := l.matcher().Matches(p, p.GetSubjects(), r.Subject); err != nil {
-			go l.metric().RequestProcessingError(*r, p, err)
-			return err
-		} else if !sm {
-			// no, continue to next policy
-			continue
+		p := policies[k]
+		e, err := evaluate(k)
+		if d != nil {
+			d.Evaluations[k] = e
 		}
 
-		// Does the resource match with one of the policies?
-		if rm, err := l.matcher().Matches(p, p.GetResources(), r.Resource); err != nil {
+		if err != nil {
 			go l.metric().RequestProcessingError(*r, p, err)
-			return errors.WithStack(err)
-		} else if !rm {
-			// no, continue to next policy
-			continue
+			return false, err
 		}
+		return e.Applies(), nil
+	})
+
+	switch errors.Cause(err) {
+	case nil:
+		d.decide(Permit, deciders)
+		l.logGrantedAccessRequest(ctx, r, policies, deciders, algorithm)
+		l.metric().RequestAllowedBy(*r, deciders)
+	case ErrRequestForcefullyDenied:
+		d.decide(Deny, deciders)
+		l.logRejectedAccessRequest(ctx, r, policies, deciders, algorithm)
 
-		// Are the policies conditions met?
-		// This is checked first because it usually has a small complexity.
-		if !l.passesConditions(ctx, p, r) {
-			// no, continue to next policy
-			continue
+		// Custom algorithms may deny forcefully without naming a policy, which is reported as a nil policy.
+		var denier Policy
+		if len(deciders) > 0 {
+			denier = deciders[len(deciders)-1]
 		}
+		go l.metric().RequestDeniedBy(*r, denier)
+	case ErrRequestDenied:
+		go l.metric().RequestNoMatch(*r)
+
+		d.decide(NotApplicable, deciders)
+		l.logRejectedAccessRequest(ctx, r, policies, deciders, algorithm)
+	case ErrRequestIndeterminate:
+		go l.metric().RequestProcessingError(*r, nil, err)
 
-		// Is the policy's effect `deny`? If yes, this overrides all allow policies -> access denied.
-		if !p.AllowAccess() {
-			deciders = append(deciders, p)
-			l.auditLogger().LogRejectedAccessRequest(ctx, r, policies, deciders)
-			go l.metric().RequestDeniedBy(*r, p)
-			return errors.WithStack(ErrRequestForcefullyDenied)
+		d.decide(Indeterminate, deciders)
+		l.logRejectedAccessRequest(ctx, r, policies, deciders, algorithm)
+	default:
+		// The error was returned by a policy evaluation and has been reported already.
+		return err
+	}
+
+	if m, ok := l.metric().(CombiningAlgorithmMetric); ok {
+		m.RequestDecidedByAlgorithm(*r, algorithm.GetName(), err == nil)
+	}
+
+	return err
+}
+
+func (l *Ladon) logGrantedAccessRequest(ctx context.Context, r *Request, pool Policies, deciders Policies, algorithm CombiningAlgorithm) {
+	if a, ok := l.auditLogger().(CombiningAlgorithmAuditLogger); ok {
+		a.LogGrantedAccessRequestByAlgorithm(ctx, r, pool, deciders, algorithm.GetName())
+		return
+	}
+	l.auditLogger().LogGrantedAccessRequest(ctx, r, pool, deciders)
+}
+
+func (l *Ladon) logRejectedAccessRequest(ctx context.Context, r *Request, pool Policies, deciders Policies, algorithm CombiningAlgorithm) {
+	if a, ok := l.auditLogger().(CombiningAlgorithmAuditLogger); ok {
+		a.LogRejectedAccessRequestByAlgorithm(ctx, r, pool, deciders, algorithm.GetName())
+		return
+	}
+	l.auditLogger().LogRejectedAccessRequest(ctx, r, pool, deciders)
+}
+
+// evaluatePolicy checks if policy p applies to the request r. Checks are short-circuited, so the returned
+// evaluation only contains the results of the checks that were actually performed.
+func (l *Ladon) evaluatePolicy(ctx context.Context, p Policy, r *Request, scope *requestScope) (e PolicyEvaluation, err error) {
+	e = PolicyEvaluation{PolicyID: p.GetID(), Policy: p, Evaluated: true}
+
+	var notSubjects, notResources, notActions []string
+	if ep, ok := p.(ExclusionPolicy); ok {
+		notSubjects, notResources, notActions = ep.GetNotSubjects(), ep.GetNotResources(), ep.GetNotActions()
+	}
+
+	// Policy variables such as ${subject} are resolved right before matching, see ResolveVariables.
+	resolve := func(haystack []string) []string {
+		return resolvePolicyVariables(p, haystack, r)
+	}
+
+	// Does the action, or one of the groups containing it, match with one of the policies?
+	// This is the first check because usually actions are a superset of get|update|delete|set
+	// and thus match faster.
+	if e.MatchedAction, e.ActionMatched, err = l.matchesAny(ctx, p, resolve(p.GetActions()), resolve(notActions), scope.actions); err != nil {
+		return e, errors.WithStack(err)
+	} else if !e.ActionMatched {
+		return e, nil
+	}
+
+	// Does the subject, or one of the roles and groups it belongs to, match with one of the policies?
+	// There are usually less subjects than resources which is why this is checked
+	// before checking for resources.
+	if e.MatchedSubject, e.SubjectMatched, err = l.matchesAny(ctx, p, resolve(p.GetSubjects()), resolve(notSubjects), scope.subjects); err != nil {
+		return e, err
+	} else if !e.SubjectMatched {
+		return e, nil
+	}
+
+	// Does the resource, or one of its ancestors, match with one of the policies?
+	if e.MatchedResource, e.ResourceMatched, err = l.matchesAny(ctx, p, resolve(p.GetResources()), resolve(notResources), scope.resources); err != nil {
+		return e, errors.WithStack(err)
+	} else if !e.ResourceMatched {
+		return e, nil
+	}
+
+	// Are the policies conditions met?
+	// This is checked first because it usually has a small complexity.
+	if e.ConditionsPassed, e.FailedCondition, err = l.passesConditions(ctx, p, r); err != nil {
+		return e, err
+	} else if !e.ConditionsPassed {
+		e.FailedConditionValue = r.Context[e.FailedCondition]
+	}
+
+	return e, nil
+}
+
+// matchesAny returns true and the first matching needle if one of the needles matches one of the haystack
+// items and none of the needles matches one of the exclusions.
+func (l *Ladon) matchesAny(ctx context.Context, p Policy, haystack []string, exclusions []string, needles []string) (string, bool, error) {
+	if len(needles) == 1 {
+		matched, err := l.matches(ctx, p, haystack, exclusions, needles[0])
+		if !matched {
+			return "", false, err
+		}
+		return needles[0], true, err
+	}
+
+	var matched string
+	var found bool
+	for _, needle := range needles {
+		if ok, err := l.match(ctx, p, haystack, needle); err != nil {
+			return "", false, err
+		} else if ok {
+			matched, found = needle, true
+			break
 		}
+	}
 
-		allowed = true
-		deciders = append(deciders, p)
+	if !found || len(exclusions) == 0 {
+		return matched, found, nil
 	}
 
-	if !allowed {
-		go l.metric().RequestNoMatch(*r)
+	for _, needle := range needles {
+		if excluded, err := l.match(ctx, p, exclusions, needle); err != nil {
+			return "", false, err
+		} else if excluded {
+			return "", false, nil
+		}
+	}
+	return matched, true, nil
+}
 
-		l.auditLogger().LogRejectedAccessRequest(ctx, r, policies, deciders)
-		return errors.WithStack(ErrRequestDenied)
+// matches returns true if needle matches one of the haystack items but none of the exclusions.
+func (l *Ladon) matches(ctx context.Context, p Policy, haystack []string, exclusions []string, needle string) (bool, error) {
+	if _, ok := l.matcher().(contextMatcher); !ok && len(exclusions) > 0 {
+		if m, ok := l.matcher().(exclusionMatcher); ok {
+			return m.MatchesExcluding(p, haystack, exclusions, needle)
+		}
 	}
 
-	l.auditLogger().LogGrantedAccessRequest(ctx, r, policies, deciders)
-	l.metric().RequestAllowedBy(*r, deciders)
+	if matched, err := l.match(ctx, p, haystack, needle); err != nil || !matched {
+		return false, err
+	} else if len(exclusions) == 0 {
+		return true, nil
+	}
+
+	excluded, err := l.match(ctx, p, exclusions, needle)
+	if err != nil {
+		return false, err
+	}
+	return !excluded, nil
+}
 
-	return nil
+// match returns true if needle matches one of the haystack items. ctx is passed to the matcher if it supports it.
+func (l *Ladon) match(ctx context.Context, p Policy, haystack []string, needle string) (bool, error) {
+	if m, ok := l.matcher().(contextMatcher); ok {
+		return m.MatchesContext(ctx, p, haystack, needle)
+	}
+	return l.matcher().Matches(p, haystack, needle)
 }
 
-func (l *Ladon) passesConditions(ctx context.Context, p Policy, r *Request) bool {
+// passesConditions returns true if all conditions of p are fulfilled and otherwise false and the key
+// of the first condition that was not fulfilled. It returns ErrRequestCanceled if ctx is canceled before
+// all conditions were checked.
+func (l *Ladon) passesConditions(ctx context.Context, p Policy, r *Request) (bool, string, error) {
 	for key, condition := range p.GetConditions() {
+		if ctx.Err() != nil {
+			return false, "", errors.WithStack(ErrRequestCanceled)
+		}
+
 		if pass := condition.Fulfills(ctx, r.Context[key], r); !pass {
-			return false
+			return false, key, nil
 		}
 	}
-	return true
+	return true, "", nil
 }
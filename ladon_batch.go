@@ -0,0 +1,95 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"sync"
+)
+
+// IsAllowedBatch decides all requests and returns one result per request, in the same order as the requests.
+// A result is nil if the request can be granted and an error otherwise, just like IsAllowed.
+//
+// Policies are fetched once per distinct subject using the manager's FindPoliciesForSubject. If BatchConcurrency
+// is greater than 1, the requests are evaluated in parallel using at most BatchConcurrency goroutines.
+func (l *Ladon) IsAllowedBatch(ctx context.Context, rs []*Request) []error {
+	results := make([]error, len(rs))
+
+	candidates := map[string]*subjectCandidates{}
+	for _, r := range rs {
+		if _, ok := candidates[r.Subject]; ok {
+			continue
+		}
+
+		c := &subjectCandidates{}
+		candidates[r.Subject] = c
+		if c.scope, c.err = l.scope(ctx, r); c.err != nil {
+			continue
+		}
+		c.policies, c.err = l.findPoliciesForSubjects(ctx, c.scope.subjects)
+	}
+
+	l.forEachRequest(len(rs), func(i int) {
+		r := rs[i]
+		c := candidates[r.Subject]
+		if c.err != nil {
+			go l.metric().RequestProcessingError(*r, nil, c.err)
+			results[i] = c.err
+			return
+		}
+
+		results[i] = l.doPoliciesAllow(ctx, r, l.newScope(r, c.scope.subjects), c.policies, nil)
+	})
+
+	return results
+}
+
+// subjectCandidates contains the scope and candidate policies shared by all requests of a subject.
+type subjectCandidates struct {
+	scope    *requestScope
+	policies Policies
+	err      error
+}
+
+// forEachRequest calls f for every index in [0, n), in parallel if BatchConcurrency permits it.
+func (l *Ladon) forEachRequest(n int, f func(i int)) {
+	if l.BatchConcurrency < 2 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	var sem = make(chan struct{}, l.BatchConcurrency)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+var _ BatchWarden = new(Ladon)
+
+func TestLadonIsAllowedBatch(t *testing.T) {
+	ctx := context.Background()
+	manager := NewMemoryManager()
+	for _, pol := range pols {
+		require.NoError(t, manager.Create(ctx, pol))
+	}
+
+	rs := make([]*Request, len(cases))
+	for k, c := range cases {
+		rs[k] = c.accessRequest
+	}
+
+	for _, concurrency := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			warden := &Ladon{Manager: manager, BatchConcurrency: concurrency}
+			results := warden.IsAllowedBatch(ctx, rs)
+			require.Len(t, results, len(cases))
+			for k, c := range cases {
+				assert.Equal(t, c.expectErr, results[k] != nil, "case=%d-%s", k, c.description)
+				assert.Equal(t, warden.IsAllowed(ctx, c.accessRequest) == nil, results[k] == nil)
+			}
+		})
+	}
+}
+
+func TestLadonIsAllowedBatchFetchesOncePerSubject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockManager(ctrl)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	warden := &Ladon{Manager: m, BatchConcurrency: 2}
+
+	m.EXPECT().FindPoliciesForSubject(ctx, "peter").Times(1).Return(Policies{
+		&DefaultPolicy{
+			ID:        "1",
+			Subjects:  []string{"peter"},
+			Effect:    AllowAccess,
+			Resources: []string{"articles:<[0-9]+>"},
+			Actions:   []string{"update"},
+		},
+	}, nil)
+	m.EXPECT().FindPoliciesForSubject(ctx, "ken").Times(1).Return(nil, errors.New("lookup failed"))
+
+	results := warden.IsAllowedBatch(ctx, []*Request{
+		{Subject: "peter", Action: "update", Resource: "articles:1"},
+		{Subject: "peter", Action: "delete", Resource: "articles:1"},
+		{Subject: "ken", Action: "update", Resource: "articles:1"},
+		{Subject: "peter", Action: "update", Resource: "articles:2"},
+		{Subject: "ken", Action: "delete", Resource: "articles:2"},
+	})
+
+	require.Len(t, results, 5)
+	assert.NoError(t, results[0])
+	assert.Equal(t, ErrRequestDenied, errors.Cause(results[1]))
+	assert.EqualError(t, results[2], "lookup failed")
+	assert.NoError(t, results[3])
+	assert.EqualError(t, results[4], "lookup failed")
+}
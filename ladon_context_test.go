@@ -0,0 +1,147 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// cancelingCondition cancels the request's context while being checked.
+type cancelingCondition struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (c *cancelingCondition) GetName() string {
+	return "cancelingCondition"
+}
+
+func (c *cancelingCondition) Fulfills(ctx context.Context, value interface{}, r *Request) bool {
+	c.calls++
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return true
+}
+
+func TestLadonCanceled(t *testing.T) {
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+	t.Run("case=canceled before evaluation", func(t *testing.T) {
+		warden := &Ladon{Manager: NewMemoryManager()}
+		require.NoError(t, warden.Manager.Create(context.Background(), &DefaultPolicy{
+			ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess,
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		d, err := warden.Explain(ctx, r)
+		assert.Equal(t, ErrRequestCanceled, errors.Cause(err))
+		assert.Equal(t, Indeterminate, d.Effect)
+		assert.False(t, d.Evaluations[0].Evaluated)
+
+		effect, err := warden.Evaluate(ctx, r)
+		assert.Equal(t, Indeterminate, effect)
+		assert.Equal(t, ErrRequestCanceled, errors.Cause(err))
+	})
+
+	t.Run("case=canceled between policies", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := &cancelingCondition{cancel: cancel}
+		second := &cancelingCondition{}
+		policies := Policies{
+			&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess,
+				Conditions: Conditions{"first": first}},
+			&DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess,
+				Conditions: Conditions{"second": second}},
+		}
+
+		err := (&Ladon{}).DoPoliciesAllow(ctx, r, policies)
+		assert.Equal(t, ErrRequestCanceled, errors.Cause(err))
+		assert.Equal(t, 1, first.calls)
+		assert.Equal(t, 0, second.calls)
+	})
+
+	t.Run("case=canceled between conditions", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := &cancelingCondition{cancel: cancel}
+		second := &cancelingCondition{cancel: cancel}
+		err := (&Ladon{}).DoPoliciesAllow(ctx, r, Policies{
+			&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess,
+				Conditions: Conditions{"first": first, "second": second}},
+		})
+		assert.Equal(t, ErrRequestCanceled, errors.Cause(err))
+		assert.Equal(t, 1, first.calls+second.calls)
+	})
+}
+
+func TestLadonDeadline(t *testing.T) {
+	// This regular expression backtracks catastrophically and runs into the matcher's timeout.
+	policies := Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"<(a+)+b>"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess},
+	}
+	r := &Request{Subject: strings.Repeat("a", 64), Action: "view", Resource: "articles:1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := (&Ladon{Matcher: NewRegexpMatcher(16)}).DoPoliciesAllow(ctx, r, policies)
+	assert.Equal(t, ErrRequestCanceled, errors.Cause(err))
+	assert.True(t, time.Since(start) < 200*time.Millisecond, "%s", time.Since(start))
+}
+
+func TestRegexpMatcherDeadline(t *testing.T) {
+	m := NewRegexpMatcher(512)
+	p := &DefaultPolicy{ID: "1"}
+
+	// Requests with different deadlines share a few variants of each regular expression.
+	for d := time.Millisecond; d <= 300*time.Millisecond; d += time.Millisecond {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		matched, err := m.MatchesContext(ctx, p, []string{"articles:<[0-9]+>"}, "articles:1")
+		cancel()
+		require.NoError(t, err)
+		assert.True(t, matched)
+	}
+	assert.True(t, m.Len() <= 5, "%d", m.Len())
+
+	// Errors other than timeouts are not reported as cancellations, even if the deadline is close.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := m.MatchesContext(ctx, p, []string{"articles:<[0-9+>"}, "articles:1")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrRequestCanceled, errors.Cause(err))
+}
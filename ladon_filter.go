@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// FilterAllowedResources returns the subset of resources on which subject is allowed to perform action with
+// context c. The order of the resources is preserved. Policies are fetched only once using the manager's
+// FindPoliciesForSubject and every resource is decided exactly like IsAllowed would decide it.
+func (l *Ladon) FilterAllowedResources(ctx context.Context, subject, action string, resources []string, c Context) ([]string, error) {
+	scope, policies, err := l.findPoliciesForSubject(ctx, subject, c)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []string{}
+	for _, resource := range resources {
+		r := &Request{Subject: subject, Action: action, Resource: resource, Context: c}
+		if ok, err := l.allows(ctx, r, l.newScope(r, scope.subjects), policies); err != nil {
+			return nil, err
+		} else if ok {
+			allowed = append(allowed, resource)
+		}
+	}
+	return allowed, nil
+}
+
+// AllowedActions returns the subset of actions subject is allowed to perform on resource with context c. The order
+// of the actions is preserved. Policies are fetched only once using the manager's FindPoliciesForSubject and every
+// action is decided exactly like IsAllowed would decide it.
+func (l *Ladon) AllowedActions(ctx context.Context, subject, resource string, actions []string, c Context) ([]string, error) {
+	scope, policies, err := l.findPoliciesForSubject(ctx, subject, c)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []string{}
+	for _, action := range actions {
+		r := &Request{Subject: subject, Action: action, Resource: resource, Context: c}
+		if ok, err := l.allows(ctx, r, l.newScope(r, scope.subjects), policies); err != nil {
+			return nil, err
+		} else if ok {
+			allowed = append(allowed, action)
+		}
+	}
+	return allowed, nil
+}
+
+func (l *Ladon) findPoliciesForSubject(ctx context.Context, subject string, c Context) (*requestScope, Policies, error) {
+	r := &Request{Subject: subject, Context: c}
+	scope, err := l.scope(ctx, r)
+	if err != nil {
+		go l.metric().RequestProcessingError(*r, nil, err)
+		return nil, nil, err
+	}
+
+	policies, err := l.findPoliciesForSubjects(ctx, scope.subjects)
+	if err != nil {
+		go l.metric().RequestProcessingError(*r, nil, err)
+		return nil, nil, err
+	}
+	return scope, policies, nil
+}
+
+// allows returns true if the request is granted, false if it is denied and an error if the request could not
+// be decided.
+func (l *Ladon) allows(ctx context.Context, r *Request, scope *requestScope, policies Policies) (bool, error) {
+	err := l.doPoliciesAllow(ctx, r, scope, policies, nil)
+	switch errors.Cause(err) {
+	case nil:
+		return true, nil
+	case ErrRequestDenied, ErrRequestForcefullyDenied, ErrRequestIndeterminate:
+		return false, nil
+	}
+	return false, err
+}
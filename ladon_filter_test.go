@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestLadonFilterAllowedResources(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.NoError(t, warden.Manager.Create(ctx, pol))
+	}
+
+	resources := []string{
+		"myrn:some.domain.com:resource:123",
+		"myrn:some.domain.com:resource:protected123",
+		"myrn:some.domain.com:resource:345",
+		"myrn:something:foo:bar",
+	}
+
+	allowed, err := warden.FilterAllowedResources(ctx, "swen", "update", resources, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"myrn:some.domain.com:resource:123", "myrn:some.domain.com:resource:345"}, allowed)
+
+	allowed, err = warden.FilterAllowedResources(ctx, "peter", "delete", resources, Context{
+		"owner":    "peter",
+		"clientIP": "127.0.0.1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"myrn:some.domain.com:resource:123", "myrn:some.domain.com:resource:345", "myrn:something:foo:bar"}, allowed)
+
+	allowed, err = warden.FilterAllowedResources(ctx, "peter", "delete", resources, Context{
+		"owner":    "peter",
+		"clientIP": "0.0.0.0",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, allowed)
+
+	allowed, err = warden.FilterAllowedResources(ctx, "max", "broadcast", resources, nil)
+	require.NoError(t, err)
+	assert.Empty(t, allowed)
+}
+
+func TestLadonAllowedActions(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, pol := range pols {
+		require.NoError(t, warden.Manager.Create(ctx, pol))
+	}
+
+	actions := []string{"create", "delete", "get", "update", "broadcast", "random"}
+
+	allowed, err := warden.AllowedActions(ctx, "max", "myrn:some.domain.com:resource:123", actions, Context{
+		"owner":    "max",
+		"clientIP": "127.0.0.1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"create", "delete", "get", "update"}, allowed)
+
+	allowed, err = warden.AllowedActions(ctx, "max", "myrn:some.domain.com:resource:123", actions, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update"}, allowed)
+
+	allowed, err = warden.AllowedActions(ctx, "ken", "myrn:some.domain.com:resource:123", actions, nil)
+	require.NoError(t, err)
+	assert.Empty(t, allowed)
+}
+
+func TestLadonFilterErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockManager(ctrl)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	warden := &Ladon{Manager: m}
+
+	m.EXPECT().FindPoliciesForSubject(ctx, "peter").Times(2).Return(nil, errors.New("lookup failed"))
+
+	_, err := warden.FilterAllowedResources(ctx, "peter", "view", []string{"articles:1"}, nil)
+	assert.EqualError(t, err, "lookup failed")
+
+	_, err = warden.AllowedActions(ctx, "peter", "articles:1", []string{"view"}, nil)
+	assert.EqualError(t, err, "lookup failed")
+}
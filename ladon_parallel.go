@@ -0,0 +1,108 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// minPolicyShardSize is the minimum number of policies a goroutine evaluates when policies are evaluated in
+// parallel. Below that, the overhead of the goroutines outweighs the gain.
+const minPolicyShardSize = 16
+
+// shortCircuitingAlgorithm is implemented by combining algorithms which never ask whether a policy applies once a
+// policy p before it applied and stopsAfter(p) is true. Parallel evaluation uses this to stop evaluating policies
+// the algorithm will not ask for.
+type shortCircuitingAlgorithm interface {
+	stopsAfter(p Policy) bool
+}
+
+// policyEvaluator returns a function which evaluates the k-th policy against the request. If EvaluationConcurrency
+// allows it, all policies are evaluated in parallel upfront and the function returns the precomputed evaluations.
+func (l *Ladon) policyEvaluator(ctx context.Context, r *Request, scope *requestScope, policies Policies, algorithm CombiningAlgorithm) func(k int) (PolicyEvaluation, error) {
+	serial := func(k int) (PolicyEvaluation, error) {
+		return l.evaluatePolicy(ctx, policies[k], r, scope)
+	}
+
+	shards := l.EvaluationConcurrency
+	if max := len(policies) / minPolicyShardSize; max < shards {
+		shards = max
+	}
+	if shards < 2 {
+		return serial
+	}
+
+	type result struct {
+		done bool
+		e    PolicyEvaluation
+		err  error
+	}
+
+	results := make([]result, len(policies))
+	cutoff := int64(math.MaxInt64)
+	stop := func(k int) {
+		for {
+			current := atomic.LoadInt64(&cutoff)
+			if int64(k) >= current || atomic.CompareAndSwapInt64(&cutoff, current, int64(k)) {
+				return
+			}
+		}
+	}
+
+	short, _ := algorithm.(shortCircuitingAlgorithm)
+	size := (len(policies) + shards - 1) / shards
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(policies); start += size {
+		end := start + size
+		if end > len(policies) {
+			end = len(policies)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for k := start; k < end; k++ {
+				// The serial evaluation would never reach policies after the cutoff.
+				if int64(k) > atomic.LoadInt64(&cutoff) || ctx.Err() != nil {
+					return
+				}
+
+				e, err := serial(k)
+				results[k] = result{done: true, e: e, err: err}
+				if err != nil || (short != nil && e.Applies() && short.stopsAfter(policies[k])) {
+					stop(k)
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	return func(k int) (PolicyEvaluation, error) {
+		if !results[k].done {
+			return serial(k)
+		}
+		return results[k].e, results[k].err
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func generateMixedPolicies(n int, seed int64) Policies {
+	random := rand.New(rand.NewSource(seed))
+	policies := make(Policies, n)
+	for i := range policies {
+		effect := AllowAccess
+		if random.Intn(20) == 0 {
+			effect = DenyAccess
+		}
+
+		policies[i] = &DefaultPolicy{
+			ID:        fmt.Sprintf("%d", i),
+			Subjects:  []string{fmt.Sprintf("<users:[0-%d]>", random.Intn(10))},
+			Actions:   []string{"<view|update>"},
+			Resources: []string{fmt.Sprintf("articles:<[0-%d]>", random.Intn(10))},
+			Effect:    effect,
+			Priority:  random.Intn(3),
+		}
+	}
+	return policies
+}
+
+func TestLadonParallelEvaluation(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range []CombiningAlgorithm{
+		&DenyOverridesAlgorithm{},
+		&PermitOverridesAlgorithm{},
+		&FirstApplicableAlgorithm{},
+		&OnlyOneApplicableAlgorithm{},
+		&HighestPriorityAlgorithm{},
+	} {
+		for seed := int64(0); seed < 5; seed++ {
+			policies := generateMixedPolicies(500, seed)
+			t.Run(fmt.Sprintf("algorithm=%s/seed=%d", algorithm.GetName(), seed), func(t *testing.T) {
+				serial := &Ladon{CombiningAlgorithm: algorithm}
+				parallel := &Ladon{CombiningAlgorithm: algorithm, EvaluationConcurrency: 8}
+
+				for i := 0; i < 10; i++ {
+					r := &Request{Subject: fmt.Sprintf("users:%d", i), Action: "view", Resource: fmt.Sprintf("articles:%d", 9-i)}
+
+					expected, expectedErr := serial.ExplainPolicies(ctx, r, policies)
+					actual, actualErr := parallel.ExplainPolicies(ctx, r, policies)
+					assert.Equal(t, errors.Cause(expectedErr), errors.Cause(actualErr))
+					assert.Equal(t, expected, actual)
+					assert.Equal(t, errors.Cause(expectedErr), errors.Cause(parallel.DoPoliciesAllow(ctx, r, policies)))
+				}
+			})
+		}
+	}
+}
+
+func TestLadonParallelEvaluationErrors(t *testing.T) {
+	ctx := context.Background()
+	policies := generateMixedPolicies(200, 1)
+	policies[150] = &DefaultPolicy{ID: "broken", Subjects: []string{"<users:[>"}, Actions: []string{"view"}, Effect: DenyAccess}
+
+	r := &Request{Subject: "users:0", Action: "view", Resource: "articles:0"}
+	expected, expectedErr := (&Ladon{}).ExplainPolicies(ctx, r, policies)
+	actual, actualErr := (&Ladon{EvaluationConcurrency: 4}).ExplainPolicies(ctx, r, policies)
+	require.Error(t, expectedErr)
+	assert.Equal(t, expectedErr.Error(), actualErr.Error())
+	assert.Equal(t, expected, actual)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	. "github.com/ory/ladon"
+	"github.com/ory/ladon/ladontest"
 	. "github.com/ory/ladon/manager/memory"
 )
 
@@ -226,7 +227,7 @@ func TestLadon(t *testing.T) {
 		require.NoError(t, err)
 		p, err := warden.Manager.Get(ctx, fmt.Sprintf("%d", i))
 		if err == nil {
-			AssertPolicyEqual(t, p, polices[0])
+			ladontest.AssertPolicyEqual(t, p, polices[0])
 		}
 	}
 
@@ -250,3 +251,47 @@ func TestLadonEmpty(t *testing.T) {
 	warden := &Ladon{Manager: NewMemoryManager()}
 	assert.NotNil(t, warden.IsAllowed(ctx, &Request{}))
 }
+
+func TestLadonExclusions(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	require.NoError(t, warden.Manager.Create(ctx, &DefaultPolicy{
+		ID:           "everything-but",
+		Description:  "This policy allows everyone but guests everything except deleting on all articles but the protected ones",
+		Subjects:     []string{"<.*>"},
+		NotSubjects:  []string{"<guest:.*>"},
+		Actions:      []string{"<.*>"},
+		NotActions:   []string{"delete"},
+		Resources:    []string{"articles:<.*>"},
+		NotResources: []string{"articles:protected", "articles:<[0-9]+>:protected"},
+		Effect:       AllowAccess,
+	}))
+
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}},
+		{r: &Request{Subject: "guest:peter", Action: "update", Resource: "articles:1"}},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:protected"}},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:1:protected"}},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:a:protected"}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "users:1"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(ctx, c.r) == nil)
+		})
+	}
+
+	matcher := NewRegexpMatcher(10)
+	p := &DefaultPolicy{}
+	ok, err := matcher.MatchesExcluding(p, []string{"<.*>"}, []string{"<(foo|bar)>"}, "foo")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = matcher.MatchesExcluding(p, []string{"<.*>"}, []string{"<(foo|bar)>"}, "baz")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = matcher.MatchesExcluding(p, []string{"<.*>"}, []string{"<(foo>"}, "baz")
+	assert.Error(t, err)
+}
@@ -18,21 +18,24 @@
  * @license 	Apache-2.0
  */
 
-package ladon_test
+// Package ladontest provides a conformance test suite for implementations of ladon.Manager.
+//
+// Run the whole suite from a test of your manager:
+//
+//	func TestManager(t *testing.T) {
+//		ladontest.RunManagerTests(t, func(t *testing.T) ladon.Manager {
+//			return NewMyManager()
+//		})
+//	}
+package ladontest
 
 import (
-	"context"
-	"fmt"
-	"reflect"
-	"testing"
+	"github.com/pborman/uuid"
 
 	"github.com/ory/ladon"
-	"github.com/pborman/uuid"
-	"github.com/pkg/errors"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
+// TestManagerPolicies are the policies used by HelperTestCreateGetDelete.
 var TestManagerPolicies = []*ladon.DefaultPolicy{
 	{
 		ID:          uuid.New(),
@@ -177,7 +180,8 @@ var TestManagerPolicies = []*ladon.DefaultPolicy{
 	},
 }
 
-var testPolicies = []*ladon.DefaultPolicy{
+// TestFindPolicies are the policies used by HelperTestFindPoliciesForSubject and HelperTestFindPoliciesForResource.
+var TestFindPolicies = []*ladon.DefaultPolicy{
 	{
 		ID:          uuid.New(),
 		Description: "description",
@@ -257,222 +261,52 @@ var testPolicies = []*ladon.DefaultPolicy{
 	},
 }
 
-func HelperTestFindPoliciesForSubject(k string, s ladon.Manager) func(t *testing.T) {
-	ctx := context.Background()
-
-	return func(t *testing.T) {
-		for _, c := range testPolicies {
-			t.Run(fmt.Sprintf("create=%s", k), func(t *testing.T) {
-				require.NoError(t, s.Create(ctx, c))
-			})
+// copyPolicies returns copies of the policies, so that tests can modify them without affecting other tests. Unless
+// keepIDs is set, the copies get new IDs.
+func copyPolicies(policies []*ladon.DefaultPolicy, keepIDs bool) []*ladon.DefaultPolicy {
+	copies := make([]*ladon.DefaultPolicy, len(policies))
+	for k, p := range policies {
+		c := *p
+		if !keepIDs {
+			c.ID = uuid.New()
 		}
-
-		res, err := s.FindRequestCandidates(ctx, &ladon.Request{
-			Subject:  "sqlmatch",
-			Resource: "article",
-			Action:   "create",
-		})
-		require.NoError(t, err)
-		require.Len(t, res, 2)
-
-		if testPolicies[0].ID == res[0].GetID() {
-			AssertPolicyEqual(t, testPolicies[0], res[0])
-			AssertPolicyEqual(t, testPolicies[1], res[1])
-		} else {
-			AssertPolicyEqual(t, testPolicies[0], res[1])
-			AssertPolicyEqual(t, testPolicies[1], res[0])
-		}
-
-		res, err = s.FindRequestCandidates(ctx, &ladon.Request{
-			Subject:  "sqlamatch",
-			Resource: "article",
-			Action:   "create",
-		})
-
-		require.NoError(t, err)
-		require.Len(t, res, 1)
-		AssertPolicyEqual(t, testPolicies[0], res[0])
+		copies[k] = &c
 	}
+	return copies
 }
 
-func HelperTestFindPoliciesForResource(k string, s ladon.Manager) func(t *testing.T) {
-	ctx := context.Background()
-
-	return func(t *testing.T) {
-		for _, c := range testPolicies {
-			t.Run(fmt.Sprintf("create=%s", k), func(t *testing.T) {
-				require.NoError(t, s.Create(ctx, c))
-			})
-		}
-
-		res, err := s.FindPoliciesForResource(ctx, "sqlmatch_resource")
-		require.NoError(t, err)
-		require.Len(t, res, 2)
-
-		if testPolicies[len(testPolicies)-2].ID == res[0].GetID() {
-			AssertPolicyEqual(t, testPolicies[len(testPolicies)-2], res[0])
-			AssertPolicyEqual(t, testPolicies[len(testPolicies)-1], res[1])
-		} else {
-			AssertPolicyEqual(t, testPolicies[len(testPolicies)-2], res[1])
-			AssertPolicyEqual(t, testPolicies[len(testPolicies)-1], res[0])
-		}
-
-		res, err = s.FindPoliciesForResource(ctx, "sqlamatch_resource")
-
-		require.NoError(t, err)
-		require.Len(t, res, 1)
-		AssertPolicyEqual(t, testPolicies[len(testPolicies)-1], res[0])
-	}
-}
-
-func AssertPolicyEqual(t *testing.T, expected, got ladon.Policy) {
-	assert.Equal(t, expected.GetID(), got.GetID())
-	assert.Equal(t, expected.GetDescription(), got.GetDescription())
-	assert.Equal(t, expected.GetEffect(), got.GetEffect())
-
-	// This won't work in the memory manager
-	//assert.NotNil(t, got.GetActions())
-	//assert.NotNil(t, got.GetResources())
-	//assert.NotNil(t, got.GetSubjects())
-
-	assert.NoError(t, testEq(expected.GetActions(), got.GetActions()))
-	assert.NoError(t, testEq(expected.GetResources(), got.GetResources()))
-	assert.NoError(t, testEq(expected.GetSubjects(), got.GetSubjects()))
-	assert.EqualValues(t, expected.GetConditions(), got.GetConditions())
-}
-
-func testEq(a, b []string) error {
-	// We don't care about nil types
-	//if a == nil && b == nil {
-	//	return true
-	//}
-	//
-	//if a == nil || b == nil {
-	//	return false
-	//}
-
-	if len(a) != len(b) {
-		return errors.Errorf("Length not equal: %v (%d) != %v (%d)", a, len(a), b, len(b))
-	}
-
-	var found bool
-	for i := range a {
-		found = false
-
-		for y := range b {
-			if a[i] == b[y] {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return errors.Errorf("No match found: %d from %v in %v", i, a, b)
-		}
-	}
-
-	return nil
-}
-
-func HelperTestGetErrors(s ladon.Manager) func(t *testing.T) {
-	ctx := context.Background()
-
-	return func(t *testing.T) {
-		_, err := s.Get(ctx, uuid.New())
-		assert.Error(t, err)
-
-		_, err = s.Get(ctx, "asdf")
-		assert.Error(t, err)
-	}
+// supersetPolicies complement TestManagerPolicies and TestFindPolicies with templates which are hard to index.
+var supersetPolicies = []*ladon.DefaultPolicy{
+	{
+		Subjects:  []string{"users:<[0-9]+>", "groups:<.*>:admins"},
+		Effect:    ladon.AllowAccess,
+		Resources: []string{"articles:<[0-9]+>", "articles"},
+		Actions:   []string{"<view|update>"},
+	},
+	{
+		Subjects:  []string{"<.*>"},
+		Effect:    ladon.DenyAccess,
+		Resources: []string{"<.*>"},
+		Actions:   []string{"<.*>"},
+	},
+	{
+		Subjects:  []string{"peter", "users:1"},
+		Effect:    ladon.AllowAccess,
+		Resources: []string{"articles:1", "users:<[0-9]+>:profile"},
+		Actions:   []string{"delete"},
+	},
+	{
+		Subjects:  []string{"users:<1|2>"},
+		Effect:    ladon.AllowAccess,
+		Resources: []string{"article"},
+		Actions:   []string{"view"},
+	},
 }
 
-func HelperTestCreateGetDelete(s ladon.Manager) func(t *testing.T) {
-	ctx := context.Background()
-
-	return func(t *testing.T) {
-		for i, c := range TestManagerPolicies {
-			t.Run(fmt.Sprintf("case=%d/id=%s/type=create", i, c.GetID()), func(t *testing.T) {
-				_, err := s.Get(ctx, c.GetID())
-				require.Error(t, err)
-				require.NoError(t, s.Create(ctx, c))
-			})
-
-			t.Run(fmt.Sprintf("case=%d/id=%s/type=query", i, c.GetID()), func(t *testing.T) {
-				get, err := s.Get(ctx, c.GetID())
-				require.NoError(t, err)
-
-				AssertPolicyEqual(t, c, get)
-			})
-
-			t.Run(fmt.Sprintf("case=%d/id=%s/type=update", i, c.GetID()), func(t *testing.T) {
-				c.Description = c.Description + "_updated"
-				require.NoError(t, s.Update(ctx, c))
-
-				get, err := s.Get(ctx, c.GetID())
-				require.NoError(t, err)
-
-				AssertPolicyEqual(t, c, get)
-			})
-
-			t.Run(fmt.Sprintf("case=%d/id=%s/type=query", i, c.GetID()), func(t *testing.T) {
-				get, err := s.Get(ctx, c.GetID())
-				require.NoError(t, err)
-
-				AssertPolicyEqual(t, c, get)
-			})
-		}
-
-		t.Run("type=query-all", func(t *testing.T) {
-			count := int64(len(TestManagerPolicies))
-
-			pols, err := s.GetAll(ctx, 100, 0)
-			require.NoError(t, err)
-			assert.Len(t, pols, len(TestManagerPolicies))
-
-			pols4, err := s.GetAll(ctx, 1, 0)
-			require.NoError(t, err)
-			assert.Len(t, pols4, 1)
-
-			pols2, err := s.GetAll(ctx, 100, count-1)
-			require.NoError(t, err)
-			assert.Len(t, pols2, 1)
-
-			pols3, err := s.GetAll(ctx, 100, count)
-			require.NoError(t, err)
-			assert.Len(t, pols3, 0)
-
-			found := map[string]int{}
-			for _, got := range pols {
-				for _, expect := range TestManagerPolicies {
-					if got.GetID() == expect.GetID() {
-						assert.ObjectsAreEqualValues(t, reflect.DeepEqual(expect, got))
-						found[got.GetID()]++
-					}
-				}
-			}
-			// for _, got := range pols {
-			// 	for _, expect := range TestManagerPolicies {
-			// 		//This is a modified equality check
-			// 		if got.GetID() == expect.GetID() && reflect.DeepEqual(got.GetResources(), expect.GetResources()) && reflect.DeepEqual(got.GetActions(), expect.GetActions()) {
-			// 			found[got.GetID()]++
-			// 		}
-			// 	}
-			// }
-			assert.Len(t, found, len(TestManagerPolicies))
-
-			for _, f := range found {
-				//This assert is supposed to pass
-				assert.Equal(t, 1, f)
-			}
-		})
-
-		for i, c := range TestManagerPolicies {
-			t.Run(fmt.Sprintf("case=%d/id=%s/type=delete", i, c.GetID()), func(t *testing.T) {
-				assert.NoError(t, s.Delete(ctx, c.ID))
-
-				_, err := s.Get(ctx, c.GetID())
-				assert.Error(t, err)
-			})
-		}
-	}
-}
+// supersetSubjects, supersetResources and supersetActions are combined to the requests used by
+// HelperTestFindCandidatesSuperset.
+var (
+	supersetSubjects  = []string{"", "peter", "max", "user", "anonymous", "foo", "sqlmatch", "sqlamatch", "supplier", "users:1", "users:12", "groups:a:admins", "nobody"}
+	supersetResources = []string{"", "article", "user", "foo", ".*", "master", "product:1", "products:attributeGroup:1", "sqlmatch_resource", "sqlamatch_resource", "articles", "articles:1", "articles:12", "users:1:profile", "none"}
+	supersetActions   = []string{"", "view", "create", "update", "delete", "disable"}
+)
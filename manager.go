@@ -20,7 +20,12 @@
 
 package ladon
 
-import "context"
+import (
+	"context"
+	"strings"
+
+	"github.com/ory/ladon/compiler"
+)
 
 // Manager is responsible for managing and persisting policies.
 type Manager interface {
@@ -55,3 +60,14 @@ type Manager interface {
 	// If an error occurs, it returns nil and the error.
 	FindPoliciesForResource(ctx context.Context, resource string) (Policies, error)
 }
+
+// IndexPrefix returns the literal part of a policy's subject, resource or action item which every matching value starts
+// with, so that managers can index policies by it. exact is true if the item contains neither a regular expression nor
+// a policy variable and therefore only matches itself.
+func IndexPrefix(p Policy, item string) (prefix string, exact bool) {
+	prefix = compiler.LiteralPrefix(item, p.GetStartDelimiter())
+	if i := strings.Index(prefix, variablePrefix); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return prefix, prefix == item
+}
@@ -0,0 +1,357 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package bolt implements a ladon.Manager which stores policies in an embedded bbolt database.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	bbolt "go.etcd.io/bbolt"
+
+	. "github.com/ory/ladon"
+)
+
+var (
+	// policiesBucket maps policy IDs to records.
+	policiesBucket = []byte("ladon_policies")
+
+	// subjectsBucket and resourcesBucket index the subjects and resources of the policies. Each holds the nested
+	// buckets exactBucket and prefixBucket with keys of the form "<value>\x00<policy id>".
+	subjectsBucket  = []byte("ladon_subjects")
+	resourcesBucket = []byte("ladon_resources")
+
+	// exactBucket indexes items without regular expressions and variables by their value.
+	exactBucket = []byte("exact")
+
+	// prefixBucket indexes all other items by their literal prefix.
+	prefixBucket = []byte("prefix")
+)
+
+// record is the value stored for a policy.
+type record struct {
+	// Seq orders the policies by their creation.
+	Seq    uint64         `json:"seq"`
+	Policy *DefaultPolicy `json:"policy"`
+}
+
+// BoltManager is an implementation of Manager which stores policies in a bbolt database.
+//
+// Every modification runs in its own transaction, which is persisted before the call returns. Policies are returned
+// as *DefaultPolicy.
+type BoltManager struct {
+	db *bbolt.DB
+}
+
+// NewBoltManager initializes a new BoltManager and creates its buckets if they don't exist.
+func NewBoltManager(db *bbolt.DB) (*BoltManager, error) {
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(policiesBucket); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{subjectsBucket, resourcesBucket} {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if _, err := b.CreateBucketIfNotExists(exactBucket); err != nil {
+				return err
+			}
+			if _, err := b.CreateBucketIfNotExists(prefixBucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &BoltManager{db: db}, nil
+}
+
+// Create persists the policy.
+func (m *BoltManager) Create(ctx context.Context, policy Policy) error {
+	return errors.WithStack(m.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(policiesBucket).Get([]byte(policy.GetID())) != nil {
+			return errors.New("Policy exists")
+		}
+		return m.put(tx, policy)
+	}))
+}
+
+// Update updates an existing policy. If the policy does not exist, it is created.
+func (m *BoltManager) Update(ctx context.Context, policy Policy) error {
+	return errors.WithStack(m.db.Update(func(tx *bbolt.Tx) error {
+		return m.put(tx, policy)
+	}))
+}
+
+// Get retrieves a policy.
+func (m *BoltManager) Get(ctx context.Context, id string) (Policy, error) {
+	var p Policy
+	if err := m.db.View(func(tx *bbolt.Tx) error {
+		r, err := getRecord(tx, id)
+		if err != nil {
+			return err
+		} else if r == nil {
+			return errors.WithStack(ErrNotFound)
+		}
+		p = r.Policy
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete removes a policy.
+func (m *BoltManager) Delete(ctx context.Context, id string) error {
+	return errors.WithStack(m.db.Update(func(tx *bbolt.Tx) error {
+		r, err := getRecord(tx, id)
+		if err != nil || r == nil {
+			return err
+		}
+
+		if err := unindex(tx, r.Policy); err != nil {
+			return err
+		}
+		return tx.Bucket(policiesBucket).Delete([]byte(id))
+	}))
+}
+
+// GetAll returns all policies ordered by their ID. All policies are read from the same transaction, so a page is
+// consistent even if policies are modified concurrently.
+func (m *BoltManager) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
+	ps := Policies{}
+	if err := m.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(policiesBucket).Cursor()
+		skipped := int64(0)
+		for k, v := c.First(); k != nil && int64(len(ps)) < limit; k, v = c.Next() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			r, err := decodeRecord(v)
+			if err != nil {
+				return err
+			}
+			ps = append(ps, r.Policy)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *BoltManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	return m.FindCandidates(ctx, []string{r.Subject}, []string{r.Resource}, []string{r.Action})
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *BoltManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	return m.find(func(tx *bbolt.Tx) map[string]struct{} {
+		return intersect(
+			lookup(tx.Bucket(subjectsBucket), subjects),
+			lookup(tx.Bucket(resourcesBucket), resources),
+		)
+	})
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *BoltManager) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
+	return m.find(func(tx *bbolt.Tx) map[string]struct{} {
+		return lookup(tx.Bucket(subjectsBucket), []string{subject})
+	})
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *BoltManager) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
+	return m.FindPoliciesForResources(ctx, []string{resource})
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *BoltManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	return m.find(func(tx *bbolt.Tx) map[string]struct{} {
+		return lookup(tx.Bucket(resourcesBucket), resources)
+	})
+}
+
+// find returns the policies with the IDs returned by ids in the order they were created.
+func (m *BoltManager) find(ids func(tx *bbolt.Tx) map[string]struct{}) (Policies, error) {
+	var records []*record
+	if err := m.db.View(func(tx *bbolt.Tx) error {
+		for id := range ids(tx) {
+			r, err := getRecord(tx, id)
+			if err != nil {
+				return err
+			} else if r != nil {
+				records = append(records, r)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	ps := make(Policies, len(records))
+	for k, r := range records {
+		ps[k] = r.Policy
+	}
+	return ps, nil
+}
+
+// put stores the policy and replaces its index entries.
+func (m *BoltManager) put(tx *bbolt.Tx, policy Policy) error {
+	b := tx.Bucket(policiesBucket)
+	r, err := getRecord(tx, policy.GetID())
+	if err != nil {
+		return err
+	}
+
+	if r == nil {
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r = &record{Seq: seq}
+	} else if err := unindex(tx, r.Policy); err != nil {
+		return err
+	}
+
+	r.Policy = ToDefaultPolicy(policy)
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Put([]byte(policy.GetID()), value); err != nil {
+		return err
+	}
+	return index(tx, r.Policy)
+}
+
+func getRecord(tx *bbolt.Tx, id string) (*record, error) {
+	v := tx.Bucket(policiesBucket).Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	return decodeRecord(v)
+}
+
+func decodeRecord(v []byte) (*record, error) {
+	var r record
+	if err := json.Unmarshal(v, &r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &r, nil
+}
+
+// indexKey returns the key of a policy item in the index and whether it is stored in the prefix bucket.
+func indexKey(p Policy, item string) ([]byte, bool) {
+	prefix, exact := IndexPrefix(p, item)
+	return []byte(prefix + "\x00" + p.GetID()), !exact
+}
+
+func index(tx *bbolt.Tx, p Policy) error {
+	return updateIndex(tx, p, func(b *bbolt.Bucket, key []byte) error {
+		return b.Put(key, []byte{})
+	})
+}
+
+func unindex(tx *bbolt.Tx, p Policy) error {
+	return updateIndex(tx, p, func(b *bbolt.Bucket, key []byte) error {
+		return b.Delete(key)
+	})
+}
+
+func updateIndex(tx *bbolt.Tx, p Policy, f func(b *bbolt.Bucket, key []byte) error) error {
+	for name, items := range map[string][]string{
+		string(subjectsBucket):  p.GetSubjects(),
+		string(resourcesBucket): p.GetResources(),
+	} {
+		field := tx.Bucket([]byte(name))
+		for _, item := range items {
+			key, prefix := indexKey(p, item)
+			b := field.Bucket(exactBucket)
+			if prefix {
+				b = field.Bucket(prefixBucket)
+			}
+			if err := f(b, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the IDs of the policies with an item that might match one of the needles.
+func lookup(field *bbolt.Bucket, needles []string) map[string]struct{} {
+	ids := map[string]struct{}{}
+	for _, needle := range needles {
+		scan(field.Bucket(exactBucket), needle, ids)
+
+		// Every literal prefix of the needle, including the empty one, might belong to a matching item.
+		for i := 0; i <= len(needle); i++ {
+			scan(field.Bucket(prefixBucket), needle[:i], ids)
+		}
+	}
+	return ids
+}
+
+// scan adds the IDs of all policies indexed with the given value to ids.
+func scan(b *bbolt.Bucket, value string, ids map[string]struct{}) {
+	prefix := []byte(value + "\x00")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids[string(k[len(prefix):])] = struct{}{}
+	}
+}
+
+func intersect(a, b map[string]struct{}) map[string]struct{} {
+	ids := map[string]struct{}{}
+	for id := range a {
+		if _, ok := b[id]; ok {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
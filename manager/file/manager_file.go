@@ -0,0 +1,392 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package file implements a read-only ladon.Manager which loads policies from a directory of JSON and YAML files.
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/compiler"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// ErrReadOnly is returned when trying to modify the policies of a FileManager. Edit the policy files instead.
+var ErrReadOnly = errors.New("Policies are loaded from files and can not be modified")
+
+// DefaultPollInterval is the interval in which Run checks the directory for changes if none is configured.
+const DefaultPollInterval = time.Second
+
+// ReloadResult describes a (re)load of the policy directory.
+type ReloadResult struct {
+	// Files are the policy files which were read, relative to the directory.
+	Files []string
+
+	// Policies is the number of policies which are served after the reload.
+	Policies int
+
+	// Err is set if the files could not be loaded. The previous policies are still served in that case.
+	Err error
+}
+
+// Config configures a FileManager.
+type Config struct {
+	// PollInterval is the interval in which Run checks the directory for changes. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+
+	// OnReload is called after the policies were reloaded because the files changed, or if reloading failed.
+	OnReload func(r ReloadResult)
+}
+
+// FileManager is a read-only implementation of Manager which serves the policies found in a directory.
+//
+// Files ending in .json, .yaml or .yml contain either a single policy or a list of policies. Subdirectories are
+// read as well, hidden files and directories are skipped. Policies are validated when they are loaded and a reload
+// only takes effect if all files are valid, otherwise the last good policies are served.
+//
+// FileManager implements Watcher, which streams the policies a reload added, changed or removed.
+type FileManager struct {
+	dir string
+	c   Config
+
+	// snapshot holds the policies which are served. Reloads replace its policies, so that watchers see the
+	// differences.
+	snapshot *memory.MemoryManager
+
+	// Mutex serializes reloads.
+	sync.Mutex
+
+	// digest is the checksum of the files which were loaded last, successfully or not.
+	digest []byte
+}
+
+// NewFileManager loads the policies found in dir and returns an error if they are invalid. Call Run to reload the
+// policies when the files change.
+func NewFileManager(dir string, c Config) (*FileManager, error) {
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+
+	m := &FileManager{dir: dir, c: c, snapshot: memory.NewMemoryManager()}
+	if _, err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload loads the policies from the directory and swaps them in if they are valid. It returns an error if the
+// policies could not be loaded, in which case the previous policies are still served.
+func (m *FileManager) Reload() (ReloadResult, error) {
+	r, _ := m.reload(true)
+	return r, r.Err
+}
+
+// Run checks the directory for changes until the context is canceled and reloads the policies if the files changed.
+// Reloads are reported through Config.OnReload.
+func (m *FileManager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if r, changed := m.reload(false); changed && m.c.OnReload != nil {
+			m.c.OnReload(r)
+		}
+	}
+}
+
+// reload loads the policies from the directory. Unless force is set, the files are only parsed if they changed since
+// the last attempt. It returns false if nothing changed.
+func (m *FileManager) reload(force bool) (ReloadResult, bool) {
+	files, digest, err := m.read()
+	if err != nil {
+		m.Lock()
+		defer m.Unlock()
+
+		// Report read errors only once, until the directory can be read again.
+		changed := force || m.digest != nil
+		m.digest = nil
+		return ReloadResult{Err: err, Policies: m.size()}, changed
+	}
+
+	m.Lock()
+	changed := force || !bytes.Equal(digest, m.digest)
+	m.Unlock()
+	if !changed {
+		return ReloadResult{}, false
+	}
+	return m.load(files, digest), true
+}
+
+// Watch streams the changes of policies caused by reloads, see Watcher. Only the most recent changes are retained for
+// resuming.
+func (m *FileManager) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	return m.snapshot.Watch(ctx, token)
+}
+
+// Create returns ErrReadOnly.
+func (m *FileManager) Create(ctx context.Context, policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update returns ErrReadOnly.
+func (m *FileManager) Update(ctx context.Context, policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete returns ErrReadOnly.
+func (m *FileManager) Delete(ctx context.Context, id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *FileManager) Get(ctx context.Context, id string) (Policy, error) {
+	return m.current().Get(ctx, id)
+}
+
+// GetAll returns all policies.
+func (m *FileManager) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
+	return m.current().GetAll(ctx, limit, offset)
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *FileManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	return m.current().FindRequestCandidates(ctx, r)
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	return m.current().FindCandidates(ctx, subjects, resources, actions)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
+	return m.current().FindPoliciesForSubject(ctx, subject)
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
+	return m.current().FindPoliciesForResource(ctx, resource)
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	return m.current().FindPoliciesForResources(ctx, resources)
+}
+
+func (m *FileManager) current() *memory.MemoryManager {
+	return m.snapshot
+}
+
+// size returns the number of policies currently served.
+func (m *FileManager) size() int {
+	m.snapshot.RLock()
+	defer m.snapshot.RUnlock()
+	return len(m.snapshot.Policies)
+}
+
+// policyFile is the content of a policy file.
+type policyFile struct {
+	name    string
+	content []byte
+}
+
+// read returns the policy files of the directory in lexical order and their checksum.
+func (m *FileManager) read() ([]policyFile, []byte, error) {
+	var files []policyFile
+	err := filepath.WalkDir(m.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != m.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() || !isPolicyFile(path) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(m.dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, policyFile{name: filepath.ToSlash(name), content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not read policy directory %s", m.dir)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00", f.name, len(f.content))
+		h.Write(f.content)
+	}
+	return files, h.Sum(nil), nil
+}
+
+// load parses and validates the files and swaps in the new policies if they are valid.
+func (m *FileManager) load(files []policyFile, digest []byte) ReloadResult {
+	r := ReloadResult{Files: make([]string, len(files))}
+	for k, f := range files {
+		r.Files[k] = f.name
+	}
+
+	policies, err := parse(files)
+
+	m.Lock()
+	defer m.Unlock()
+	m.digest = digest
+	if err == nil {
+		err = m.snapshot.Replace(context.Background(), policies)
+	}
+	r.Err = err
+	r.Policies = m.size()
+	return r
+}
+
+// parse returns the policies of the files.
+func parse(files []policyFile) (Policies, error) {
+	policies := Policies{}
+	sources := map[string]string{}
+
+	for _, f := range files {
+		decoded, err := decode(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not parse policy file %s", f.name)
+		}
+
+		for k, p := range decoded {
+			if err := validate(p); err != nil {
+				return nil, errors.Wrapf(err, "Policy %d in file %s is invalid", k, f.name)
+			}
+			if source, ok := sources[p.ID]; ok {
+				return nil, errors.Errorf("Policy %s in file %s is already defined in file %s", p.ID, f.name, source)
+			}
+			sources[p.ID] = f.name
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// decode returns the policies of a file, which contains either a single policy or a list of policies.
+func decode(f policyFile) ([]*DefaultPolicy, error) {
+	content := f.content
+	if ext := filepath.Ext(f.name); ext == ".yaml" || ext == ".yml" {
+		var err error
+		if content, err = yaml.YAMLToJSON(content); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 || bytes.Equal(content, []byte("null")) {
+		return nil, nil
+	}
+
+	if content[0] != '[' {
+		var p DefaultPolicy
+		if err := json.Unmarshal(content, &p); err != nil {
+			return nil, err
+		}
+		return []*DefaultPolicy{&p}, nil
+	}
+
+	var policies []*DefaultPolicy
+	if err := json.Unmarshal(content, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// validate checks that the policy has an ID, a valid effect and valid regular expressions.
+func validate(p *DefaultPolicy) error {
+	if p == nil {
+		return errors.New("Policy must not be empty")
+	} else if p.ID == "" {
+		return errors.New("Policy has no ID")
+	} else if p.Effect != AllowAccess && p.Effect != DenyAccess {
+		return errors.Errorf("Policy %s has effect \"%s\" but must be either \"%s\" or \"%s\"", p.ID, p.Effect, AllowAccess, DenyAccess)
+	}
+
+	for _, items := range [][]string{p.Subjects, p.Resources, p.Actions, p.NotSubjects, p.NotResources, p.NotActions} {
+		for _, item := range items {
+			if strings.IndexByte(item, p.GetStartDelimiter()) == -1 {
+				continue
+			}
+			if _, err := compiler.CompileRegex(item, p.GetStartDelimiter(), p.GetEndDelimiter()); err != nil {
+				return errors.Wrapf(err, "Policy %s contains invalid template %s", p.ID, item)
+			}
+		}
+	}
+	return nil
+}
+
+func isPolicyFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
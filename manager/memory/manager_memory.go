@@ -22,7 +22,9 @@ package memory
 
 import (
 	"context"
+	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -32,15 +34,35 @@ import (
 )
 
 // MemoryManager is an in-memory (non-persistent) implementation of Manager.
+//
+// Policies are indexed by their subjects, resources and actions, so that only policies which might match a request
+// are returned as candidates. Policies must therefore be modified through Create, Update and Delete. Policies which
+// are added to the Policies map directly are indexed once the number of policies changes.
 type MemoryManager struct {
 	Policies map[string]Policy
 	sync.RWMutex
+
+	// created keeps track of the order in which policies were created.
+	created map[string]uint64
+	seq     uint64
+
+	// revisions holds the revision of every policy, see RevisionManager. Revisions are taken from a counter which is
+	// shared by all policies, so a policy which is deleted and created again never gets a previous revision.
+	revisions map[string]uint64
+	revision  uint64
+
+	index *policyIndex
+
+	// events holds the recent changes, see Watch.
+	events eventLog
 }
 
 // NewMemoryManager constructs and initializes new MemoryManager with no policies.
 func NewMemoryManager() *MemoryManager {
 	return &MemoryManager{
-		Policies: map[string]Policy{},
+		Policies:  map[string]Policy{},
+		created:   map[string]uint64{},
+		revisions: map[string]uint64{},
 	}
 }
 
@@ -48,10 +70,42 @@ func NewMemoryManager() *MemoryManager {
 func (m *MemoryManager) Update(ctx context.Context, policy Policy) error {
 	m.Lock()
 	defer m.Unlock()
-	m.Policies[policy.GetID()] = policy
+	m.put(policy)
 	return nil
 }
 
+// put stores the policy and assigns it a new revision. The caller must hold the write lock.
+func (m *MemoryManager) put(policy Policy) uint64 {
+	old, found := m.Policies[policy.GetID()]
+	if found {
+		m.events.append(PolicyEvent{Type: PolicyUpdated, ID: policy.GetID(), Old: old, New: policy})
+	} else {
+		m.events.append(PolicyEvent{Type: PolicyCreated, ID: policy.GetID(), New: policy})
+	}
+
+	m.track(policy.GetID())
+	m.Policies[policy.GetID()] = policy
+	m.indexPolicy(policy)
+
+	if m.revisions == nil {
+		m.revisions = map[string]uint64{}
+	}
+	m.revision++
+	m.revisions[policy.GetID()] = m.revision
+	return m.revision
+}
+
+// track remembers when the policy with the given id was created, unless it is known already.
+func (m *MemoryManager) track(id string) {
+	if m.created == nil {
+		m.created = map[string]uint64{}
+	}
+	if _, ok := m.created[id]; !ok {
+		m.seq++
+		m.created[id] = m.seq
+	}
+}
+
 // GetAll returns all policies.
 func (m *MemoryManager) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
 	keys := make([]string, len(m.Policies))
@@ -83,7 +137,7 @@ func (m *MemoryManager) Create(ctx context.Context, policy Policy) error {
 		return errors.New("Policy exists")
 	}
 
-	m.Policies[policy.GetID()] = policy
+	m.put(policy)
 	return nil
 }
 
@@ -93,7 +147,7 @@ func (m *MemoryManager) Get(ctx context.Context, id string) (Policy, error) {
 	defer m.RUnlock()
 	p, ok := m.Policies[id]
 	if !ok {
-		return nil, errors.New("Not found")
+		return nil, errors.WithStack(ErrNotFound)
 	}
 
 	return p, nil
@@ -103,39 +157,250 @@ func (m *MemoryManager) Get(ctx context.Context, id string) (Policy, error) {
 func (m *MemoryManager) Delete(ctx context.Context, id string) error {
 	m.Lock()
 	defer m.Unlock()
-	delete(m.Policies, id)
+	m.remove(id)
+	return nil
+}
+
+// Replace replaces all policies with the given ones in a single step. Policies which did not change are kept as they
+// are, so watchers only see the policies which were created, updated or deleted.
+func (m *MemoryManager) Replace(ctx context.Context, policies Policies) error {
+	keep := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		if keep[p.GetID()] {
+			return errors.Errorf("Policy %s is given more than once", p.GetID())
+		}
+		keep[p.GetID()] = true
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	var removed []string
+	for id := range m.Policies {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		m.remove(id)
+	}
+
+	for _, p := range policies {
+		if old, ok := m.Policies[p.GetID()]; ok && reflect.DeepEqual(old, p) {
+			continue
+		}
+		m.put(p)
+	}
 	return nil
 }
 
-func (m *MemoryManager) findAllPolicies() (Policies, error) {
+// GetWithRevision retrieves a policy and its current revision.
+func (m *MemoryManager) GetWithRevision(ctx context.Context, id string) (Policy, string, error) {
 	m.RLock()
 	defer m.RUnlock()
-	ps := make(Policies, len(m.Policies))
-	var count int
+	p, ok := m.Policies[id]
+	if !ok {
+		return nil, "", errors.WithStack(ErrNotFound)
+	}
+
+	return p, formatRevision(m.revisions[id]), nil
+}
+
+// UpdateIfRevision updates an existing policy if its current revision equals revision and returns the new revision.
+func (m *MemoryManager) UpdateIfRevision(ctx context.Context, policy Policy, revision string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.checkRevision(policy.GetID(), revision); err != nil {
+		return "", err
+	}
+
+	return formatRevision(m.put(policy)), nil
+}
+
+// DeleteIfRevision removes a policy if its current revision equals revision.
+func (m *MemoryManager) DeleteIfRevision(ctx context.Context, id string, revision string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.checkRevision(id, revision); err != nil {
+		return err
+	}
+
+	m.remove(id)
+	return nil
+}
+
+// checkRevision returns an error if the policy does not exist or has another revision. The caller must hold the
+// lock.
+func (m *MemoryManager) checkRevision(id string, revision string) error {
+	if _, ok := m.Policies[id]; !ok {
+		return errors.WithStack(ErrNotFound)
+	}
+
+	if actual := formatRevision(m.revisions[id]); actual != revision {
+		return NewConflictError(id, revision, actual)
+	}
+	return nil
+}
+
+func formatRevision(revision uint64) string {
+	return strconv.FormatUint(revision, 10)
+}
+
+// remove deletes the policy. The caller must hold the write lock.
+func (m *MemoryManager) remove(id string) {
+	if old, found := m.Policies[id]; found {
+		m.events.append(PolicyEvent{Type: PolicyDeleted, ID: id, Old: old})
+	}
+
+	delete(m.Policies, id)
+	delete(m.created, id)
+	delete(m.revisions, id)
+	if m.index != nil {
+		m.index.remove(id)
+	}
+}
+
+// indexPolicy adds the policy to the index. The caller must hold the write lock.
+func (m *MemoryManager) indexPolicy(policy Policy) {
+	if m.index != nil {
+		indexed := len(m.index.entries)
+		if _, ok := m.index.entries[policy.GetID()]; !ok {
+			indexed++
+		}
+
+		if indexed == len(m.Policies) {
+			m.index.add(policy)
+			return
+		}
+	}
+
+	// The index has not been built yet or policies were added to the Policies map directly.
+	m.reindex()
+}
+
+// reindex rebuilds the index from scratch. The caller must hold the write lock.
+func (m *MemoryManager) reindex() {
+	m.index = newPolicyIndex()
 	for _, p := range m.Policies {
-		ps[count] = p
-		count++
+		m.index.add(p)
 	}
-	return ps, nil
+}
+
+// rlockIndexed acquires the read lock and makes sure that the index is up to date.
+func (m *MemoryManager) rlockIndexed() {
+	m.RLock()
+	if m.index != nil && len(m.index.entries) == len(m.Policies) {
+		return
+	}
+	m.RUnlock()
+
+	m.Lock()
+	if m.index == nil || len(m.index.entries) != len(m.Policies) {
+		m.reindex()
+	}
+	m.Unlock()
+	m.RLock()
+}
+
+// sortedPolicies returns the policies with the given IDs in the order they were created. Policies which were added to
+// the Policies map directly come first, ordered by their ID. The caller must hold the read lock.
+func (m *MemoryManager) sortedPolicies(ids []string) Policies {
+	sort.Slice(ids, func(i, j int) bool {
+		if m.created[ids[i]] != m.created[ids[j]] {
+			return m.created[ids[i]] < m.created[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	ps := make(Policies, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := m.Policies[id]; ok {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// findPolicies returns the policies with the given IDs in the order they were created.
+func (m *MemoryManager) findPolicies(ids idSet) Policies {
+	keys := make([]string, 0, len(ids))
+	for id := range ids {
+		keys = append(keys, id)
+	}
+	return m.sortedPolicies(keys)
 }
 
 // FindRequestCandidates returns candidates that could match the request object. It either returns
 // a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
 // the error.
 func (m *MemoryManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
-	return m.findAllPolicies()
+	m.rlockIndexed()
+	defer m.RUnlock()
+
+	subjects, resources, actions := idSet{}, idSet{}, idSet{}
+	m.index.subjects.find(r.Subject, subjects)
+	m.index.resources.find(r.Resource, resources)
+	m.index.actions.find(r.Action, actions)
+	return m.findPolicies(intersect(subjects, resources, actions)), nil
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *MemoryManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	m.rlockIndexed()
+	defer m.RUnlock()
+
+	subjectIDs, resourceIDs, actionIDs := idSet{}, idSet{}, idSet{}
+	for _, subject := range subjects {
+		m.index.subjects.find(subject, subjectIDs)
+	}
+	for _, resource := range resources {
+		m.index.resources.find(resource, resourceIDs)
+	}
+	for _, action := range actions {
+		m.index.actions.find(action, actionIDs)
+	}
+	return m.findPolicies(intersect(subjectIDs, resourceIDs, actionIDs)), nil
 }
 
 // FindPoliciesForSubject returns policies that could match the subject. It either returns
 // a set of policies that applies to the subject, or a superset of it.
 // If an error occurs, it returns nil and the error.
 func (m *MemoryManager) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
-	return m.findAllPolicies()
+	m.rlockIndexed()
+	defer m.RUnlock()
+
+	ids := idSet{}
+	m.index.subjects.find(subject, ids)
+	return m.findPolicies(ids), nil
 }
 
 // FindPoliciesForResource returns policies that could match the resource. It either returns
 // a set of policies that apply to the resource, or a superset of it.
 // If an error occurs, it returns nil and the error.
 func (m *MemoryManager) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
-	return m.findAllPolicies()
+	m.rlockIndexed()
+	defer m.RUnlock()
+
+	ids := idSet{}
+	m.index.resources.find(resource, ids)
+	return m.findPolicies(ids), nil
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *MemoryManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	m.rlockIndexed()
+	defer m.RUnlock()
+
+	ids := idSet{}
+	for _, resource := range resources {
+		m.index.resources.find(resource, ids)
+	}
+	return m.findPolicies(ids), nil
 }
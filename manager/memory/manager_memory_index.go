@@ -0,0 +1,176 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	. "github.com/ory/ladon"
+)
+
+// idSet is a set of policy IDs.
+type idSet map[string]struct{}
+
+// fieldIndex indexes the subjects, resources or actions of policies. Items without regular expressions and
+// variables are indexed by their exact value, all other items by their literal prefix.
+type fieldIndex struct {
+	exact    map[string]idSet
+	prefixes map[string]idSet
+}
+
+// indexKey is an entry of a fieldIndex.
+type indexKey struct {
+	value  string
+	prefix bool
+}
+
+func newFieldIndex() *fieldIndex {
+	return &fieldIndex{exact: map[string]idSet{}, prefixes: map[string]idSet{}}
+}
+
+// indexKeys returns the index keys of the given policy items, see IndexPrefix.
+func indexKeys(p Policy, items []string) []indexKey {
+	keys := make([]indexKey, len(items))
+	for k, item := range items {
+		prefix, exact := IndexPrefix(p, item)
+		keys[k] = indexKey{value: prefix, prefix: !exact}
+	}
+	return keys
+}
+
+func (f *fieldIndex) bucket(key indexKey) map[string]idSet {
+	if key.prefix {
+		return f.prefixes
+	}
+	return f.exact
+}
+
+func (f *fieldIndex) add(id string, keys []indexKey) {
+	for _, key := range keys {
+		bucket := f.bucket(key)
+		if bucket[key.value] == nil {
+			bucket[key.value] = idSet{}
+		}
+		bucket[key.value][id] = struct{}{}
+	}
+}
+
+func (f *fieldIndex) remove(id string, keys []indexKey) {
+	for _, key := range keys {
+		bucket := f.bucket(key)
+		delete(bucket[key.value], id)
+		if len(bucket[key.value]) == 0 {
+			delete(bucket, key.value)
+		}
+	}
+}
+
+// find adds the IDs of all policies with an item which might match needle to ids.
+func (f *fieldIndex) find(needle string, ids idSet) {
+	for id := range f.exact[needle] {
+		ids[id] = struct{}{}
+	}
+
+	if len(f.prefixes) == 0 {
+		return
+	}
+	for i := 0; i <= len(needle); i++ {
+		for id := range f.prefixes[needle[:i]] {
+			ids[id] = struct{}{}
+		}
+	}
+}
+
+// policyIndex indexes the subjects, resources and actions of all policies of a MemoryManager.
+type policyIndex struct {
+	subjects  *fieldIndex
+	resources *fieldIndex
+	actions   *fieldIndex
+
+	// entries contains the keys every policy was indexed with, so that they can be removed even if the policy was
+	// modified in the meantime.
+	entries map[string]*indexEntry
+}
+
+type indexEntry struct {
+	subjects  []indexKey
+	resources []indexKey
+	actions   []indexKey
+}
+
+func newPolicyIndex() *policyIndex {
+	return &policyIndex{
+		subjects:  newFieldIndex(),
+		resources: newFieldIndex(),
+		actions:   newFieldIndex(),
+		entries:   map[string]*indexEntry{},
+	}
+}
+
+// add indexes the policy. If a policy with the same ID was indexed before, it is replaced.
+func (x *policyIndex) add(p Policy) {
+	x.remove(p.GetID())
+
+	e := &indexEntry{
+		subjects:  indexKeys(p, p.GetSubjects()),
+		resources: indexKeys(p, p.GetResources()),
+		actions:   indexKeys(p, p.GetActions()),
+	}
+	x.subjects.add(p.GetID(), e.subjects)
+	x.resources.add(p.GetID(), e.resources)
+	x.actions.add(p.GetID(), e.actions)
+	x.entries[p.GetID()] = e
+}
+
+func (x *policyIndex) remove(id string) {
+	e, ok := x.entries[id]
+	if !ok {
+		return
+	}
+
+	x.subjects.remove(id, e.subjects)
+	x.resources.remove(id, e.resources)
+	x.actions.remove(id, e.actions)
+	delete(x.entries, id)
+}
+
+// intersect returns the IDs which are part of all sets.
+func intersect(sets ...idSet) idSet {
+	smallest := sets[0]
+	for _, s := range sets[1:] {
+		if len(s) < len(smallest) {
+			smallest = s
+		}
+	}
+
+	result := idSet{}
+	for id := range smallest {
+		found := true
+		for _, s := range sets {
+			if _, ok := s[id]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			result[id] = struct{}{}
+		}
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// eventLogSize is the number of changes a MemoryManager retains for watchers which resume or fall behind.
+const eventLogSize = 1024
+
+// eventLog holds the most recent changes of a MemoryManager. The token of an event is its sequence number.
+type eventLog struct {
+	events []PolicyEvent
+
+	// seq is the sequence number of the last event.
+	seq uint64
+
+	// changed is closed when an event is appended.
+	changed chan struct{}
+}
+
+// append records the event. The caller must hold the write lock.
+func (l *eventLog) append(e PolicyEvent) {
+	l.seq++
+	e.Token = strconv.FormatUint(l.seq, 10)
+	l.events = append(l.events, e)
+	if len(l.events) > eventLogSize {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// since returns the events after the given sequence number and a channel which is closed on the next change. ok is
+// false if some of these events are no longer retained. The caller must hold the write lock.
+func (l *eventLog) since(seq uint64) (events []PolicyEvent, changed <-chan struct{}, ok bool) {
+	if first := l.seq - uint64(len(l.events)); seq < first || seq > l.seq {
+		return nil, nil, false
+	}
+
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+
+	pending := l.events[uint64(len(l.events))-(l.seq-seq):]
+	return append([]PolicyEvent(nil), pending...), l.changed, true
+}
+
+// Watch streams the changes of policies, see Watcher. Only the last 1024 changes are retained for resuming.
+func (m *MemoryManager) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	m.Lock()
+	cursor := m.events.seq
+	if token != "" {
+		seq, err := strconv.ParseUint(token, 10, 64)
+		if err != nil {
+			m.Unlock()
+			return nil, errors.Errorf("Invalid resume token \"%s\"", token)
+		}
+
+		// A token beyond the last event was issued by another instance, whose changes are unknown.
+		if _, _, ok := m.events.since(seq); !ok {
+			m.Unlock()
+			return nil, errors.WithStack(ErrWatchTokenExpired)
+		}
+		cursor = seq
+	}
+	m.Unlock()
+
+	events := make(chan PolicyEvent)
+	go func() {
+		defer close(events)
+		for {
+			m.Lock()
+			pending, changed, ok := m.events.since(cursor)
+			m.Unlock()
+			if !ok {
+				// The receiver fell behind, it has to resume with the token of the last event it received.
+				return
+			}
+
+			for _, e := range pending {
+				select {
+				case events <- e:
+					cursor++
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if len(pending) == 0 {
+				select {
+				case <-changed:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package redis implements a ladon.Manager which stores policies in Redis and publishes changes to them, so that
+// replicas can keep a local snapshot of the policies up to date.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// DefaultPrefix is the prefix of all keys and channels if none is configured.
+const DefaultPrefix = "ladon"
+
+// maxTransactionRetries is the number of times a write is retried if the policy was modified concurrently.
+const maxTransactionRetries = 16
+
+// Change is published to the changes channel whenever a policy is created, updated or deleted.
+type Change struct {
+	Type ChangeType `json:"type"`
+	ID   string     `json:"id"`
+}
+
+// RedisManager is a Redis implementation of Manager.
+//
+// Every policy is stored in a hash holding the policy and its creation sequence number. The IDs of all policies are
+// kept in a sorted set and the subjects and resources of the policies are indexed in sets. Items without regular
+// expressions and variables are indexed by their value, all other items by their literal prefix.
+type RedisManager struct {
+	db     *redis.Client
+	prefix string
+}
+
+// NewRedisManager initializes a new RedisManager. All keys and the changes channel start with prefix, which defaults
+// to DefaultPrefix.
+func NewRedisManager(db *redis.Client, prefix string) *RedisManager {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &RedisManager{db: db, prefix: prefix}
+}
+
+// Channel returns the name of the channel changes are published to.
+func (m *RedisManager) Channel() string {
+	return m.prefix + ":changes"
+}
+
+// Create persists the policy.
+func (m *RedisManager) Create(ctx context.Context, policy Policy) error {
+	return m.write(ctx, policy.GetID(), func(tx *redis.Tx, old *record) (*record, error) {
+		if old != nil {
+			return nil, errors.New("Policy exists")
+		}
+
+		seq, err := tx.Incr(ctx, m.key("seq")).Result()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &record{Seq: seq, Policy: ToDefaultPolicy(policy)}, nil
+	})
+}
+
+// Update updates an existing policy. If the policy does not exist, it is created.
+func (m *RedisManager) Update(ctx context.Context, policy Policy) error {
+	return m.write(ctx, policy.GetID(), func(tx *redis.Tx, old *record) (*record, error) {
+		if old != nil {
+			return &record{Seq: old.Seq, Policy: ToDefaultPolicy(policy)}, nil
+		}
+
+		seq, err := tx.Incr(ctx, m.key("seq")).Result()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &record{Seq: seq, Policy: ToDefaultPolicy(policy)}, nil
+	})
+}
+
+// Delete removes a policy.
+func (m *RedisManager) Delete(ctx context.Context, id string) error {
+	return m.write(ctx, id, func(tx *redis.Tx, old *record) (*record, error) {
+		return nil, nil
+	})
+}
+
+// Get retrieves a policy.
+func (m *RedisManager) Get(ctx context.Context, id string) (Policy, error) {
+	r, err := m.get(ctx, m.db, id)
+	if err != nil {
+		return nil, err
+	} else if r == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return r.Policy, nil
+}
+
+// GetAll returns all policies ordered by their ID.
+func (m *RedisManager) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
+	if limit <= 0 {
+		return Policies{}, nil
+	}
+
+	ids, err := m.db.ZRange(ctx, m.key("policies"), offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	records, err := m.records(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make(Policies, len(records))
+	for k, r := range records {
+		ps[k] = r.Policy
+	}
+	return ps, nil
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *RedisManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	return m.FindCandidates(ctx, []string{r.Subject}, []string{r.Resource}, []string{r.Action})
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *RedisManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	if len(subjects) == 0 || len(resources) == 0 || len(actions) == 0 {
+		return Policies{}, nil
+	}
+
+	subjectIDs := m.db.SUnion(ctx, m.lookupKeys("subject", subjects)...)
+	resourceIDs := m.db.SUnion(ctx, m.lookupKeys("resource", resources)...)
+	if err := subjectIDs.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	} else if err := resourceIDs.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	candidates := map[string]bool{}
+	for _, id := range subjectIDs.Val() {
+		candidates[id] = true
+	}
+
+	var ids []string
+	for _, id := range resourceIDs.Val() {
+		if candidates[id] {
+			ids = append(ids, id)
+		}
+	}
+	return m.find(ctx, ids)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *RedisManager) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
+	ids, err := m.db.SUnion(ctx, m.lookupKeys("subject", []string{subject})...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m.find(ctx, ids)
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *RedisManager) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
+	return m.FindPoliciesForResources(ctx, []string{resource})
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *RedisManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	ids, err := m.db.SUnion(ctx, m.lookupKeys("resource", resources)...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m.find(ctx, ids)
+}
+
+// record is the content of a policy hash.
+type record struct {
+	Seq    int64
+	Policy *DefaultPolicy
+}
+
+func (m *RedisManager) key(parts ...string) string {
+	return m.prefix + ":" + strings.Join(parts, ":")
+}
+
+func (m *RedisManager) policyKey(id string) string {
+	return m.key("policy", id)
+}
+
+// write runs f in a transaction which watches the policy with the given id. f receives the stored record, or nil if
+// the policy does not exist, and returns the record to store, or nil to delete the policy.
+func (m *RedisManager) write(ctx context.Context, id string, f func(tx *redis.Tx, old *record) (*record, error)) error {
+	for i := 0; i < maxTransactionRetries; i++ {
+		err := m.db.Watch(ctx, func(tx *redis.Tx) error {
+			old, err := m.get(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+
+			r, err := f(tx, old)
+			if err != nil {
+				return err
+			} else if r == nil && old == nil {
+				return nil
+			}
+
+			change := Change{ID: id, Type: PolicyDeleted}
+			if r != nil && old != nil {
+				change.Type = PolicyUpdated
+			} else if r != nil {
+				change.Type = PolicyCreated
+			}
+
+			event, err := json.Marshal(change)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			var policy []byte
+			if r != nil {
+				if policy, err = json.Marshal(r.Policy); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if old != nil {
+					m.updateIndex(ctx, pipe, old.Policy, pipe.SRem)
+				}
+
+				if r == nil {
+					pipe.Del(ctx, m.policyKey(id))
+					pipe.ZRem(ctx, m.key("policies"), id)
+				} else {
+					pipe.HSet(ctx, m.policyKey(id), "seq", r.Seq, "policy", policy)
+					pipe.ZAdd(ctx, m.key("policies"), &redis.Z{Member: id})
+					m.updateIndex(ctx, pipe, r.Policy, pipe.SAdd)
+				}
+
+				pipe.Publish(ctx, m.Channel(), event)
+				return nil
+			})
+			return err
+		}, m.policyKey(id))
+
+		if err != redis.TxFailedErr {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.Errorf("Policy %s was modified concurrently too often", id)
+}
+
+// get returns the stored record of the policy or nil if it does not exist.
+func (m *RedisManager) get(ctx context.Context, db redis.Cmdable, id string) (*record, error) {
+	values, err := db.HMGet(ctx, m.policyKey(id), "seq", "policy").Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return decodeRecord(values)
+}
+
+// records returns the stored records of the policies in the given order. Policies which don't exist are skipped.
+func (m *RedisManager) records(ctx context.Context, ids []string) ([]*record, error) {
+	cmds := make([]*redis.SliceCmd, len(ids))
+	if _, err := m.db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for k, id := range ids {
+			cmds[k] = pipe.HMGet(ctx, m.policyKey(id), "seq", "policy")
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	records := make([]*record, 0, len(ids))
+	for _, cmd := range cmds {
+		r, err := decodeRecord(cmd.Val())
+		if err != nil {
+			return nil, err
+		} else if r != nil {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// find returns the policies with the given IDs in the order they were created.
+func (m *RedisManager) find(ctx context.Context, ids []string) (Policies, error) {
+	records, err := m.records(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	ps := make(Policies, len(records))
+	for k, r := range records {
+		ps[k] = r.Policy
+	}
+	return ps, nil
+}
+
+func decodeRecord(values []interface{}) (*record, error) {
+	if len(values) != 2 || values[0] == nil || values[1] == nil {
+		return nil, nil
+	}
+
+	seq, err := strconv.ParseInt(values[0].(string), 10, 64)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var p DefaultPolicy
+	if err := json.Unmarshal([]byte(values[1].(string)), &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &record{Seq: seq, Policy: &p}, nil
+}
+
+// indexKey returns the key of the set which indexes the given item of a policy.
+func (m *RedisManager) indexKey(p Policy, field string, item string) string {
+	if prefix, exact := IndexPrefix(p, item); !exact {
+		return m.key(field, "prefix", prefix)
+	}
+	return m.key(field, "exact", item)
+}
+
+// lookupKeys returns the keys of all sets which might contain policies with an item matching one of the needles.
+func (m *RedisManager) lookupKeys(field string, needles []string) []string {
+	var keys []string
+	for _, needle := range needles {
+		keys = append(keys, m.key(field, "exact", needle))
+
+		// Every literal prefix of the needle, including the empty one, might belong to a matching item.
+		for i := 0; i <= len(needle); i++ {
+			keys = append(keys, m.key(field, "prefix", needle[:i]))
+		}
+	}
+	return keys
+}
+
+func (m *RedisManager) updateIndex(ctx context.Context, pipe redis.Pipeliner, p Policy, f func(ctx context.Context, key string, members ...interface{}) *redis.IntCmd) {
+	for _, item := range p.GetSubjects() {
+		f(ctx, m.indexKey(p, "subject", item), p.GetID())
+	}
+	for _, item := range p.GetResources() {
+		f(ctx, m.indexKey(p, "resource", item), p.GetID())
+	}
+}
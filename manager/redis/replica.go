@@ -0,0 +1,222 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// RedisReplica is a Manager which serves policies from a local snapshot of a RedisManager. Run keeps the snapshot up
+// to date by subscribing to the changes published by the RedisManager. Modifications are written to Redis and
+// applied to the local snapshot right away.
+//
+// RedisReplica implements Watcher, which streams the changes applied to the local snapshot.
+type RedisReplica struct {
+	m *RedisManager
+
+	// OnSync is called after the snapshot was reloaded from Redis, which happens whenever Run (re)subscribes to the
+	// changes channel and when a change could not be applied. It must be set before calling Run.
+	OnSync func(err error)
+
+	// snapshot holds the policies which are served. Reloads replace its policies, so that watchers see the
+	// differences.
+	snapshot *memory.MemoryManager
+}
+
+// NewRedisReplica loads the policies of the RedisManager into a local snapshot.
+func NewRedisReplica(ctx context.Context, m *RedisManager) (*RedisReplica, error) {
+	r := &RedisReplica{m: m, snapshot: memory.NewMemoryManager()}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload replaces the local snapshot with the policies stored in Redis.
+func (r *RedisReplica) Reload(ctx context.Context) error {
+	ids, err := r.m.db.ZRange(ctx, r.m.key("policies"), 0, -1).Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	records, err := r.m.records(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	// Add the policies in the order they were created, so that the snapshot returns candidates in the same order as
+	// the RedisManager.
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	policies := make(Policies, len(records))
+	for k, record := range records {
+		policies[k] = record.Policy
+	}
+	return r.snapshot.Replace(ctx, policies)
+}
+
+// Run applies the changes published by the RedisManager to the local snapshot until the context is canceled.
+func (r *RedisReplica) Run(ctx context.Context) error {
+	pubsub := r.m.db.Subscribe(ctx, r.m.Channel())
+	defer pubsub.Close()
+
+	messages := pubsub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-messages:
+			if !ok {
+				return errors.New("Subscription to policy changes was closed")
+			}
+
+			switch message := message.(type) {
+			case *redis.Subscription:
+				// Changes might have been missed before (re)subscribing.
+				r.sync(ctx)
+			case *redis.Message:
+				if err := r.apply(ctx, message.Payload); err != nil {
+					r.sync(ctx)
+				}
+			}
+		}
+	}
+}
+
+// Watch streams the changes applied to the local snapshot, see Watcher. Reloads are streamed as the policies which
+// were created, updated or deleted in the meantime. Only the most recent changes are retained for resuming.
+func (r *RedisReplica) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	return r.snapshot.Watch(ctx, token)
+}
+
+// Create persists the policy.
+func (r *RedisReplica) Create(ctx context.Context, policy Policy) error {
+	if err := r.m.Create(ctx, policy); err != nil {
+		return err
+	}
+	return r.refresh(ctx, policy.GetID())
+}
+
+// Update updates an existing policy. If the policy does not exist, it is created.
+func (r *RedisReplica) Update(ctx context.Context, policy Policy) error {
+	if err := r.m.Update(ctx, policy); err != nil {
+		return err
+	}
+	return r.refresh(ctx, policy.GetID())
+}
+
+// Delete removes a policy.
+func (r *RedisReplica) Delete(ctx context.Context, id string) error {
+	if err := r.m.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.current().Delete(ctx, id)
+}
+
+// Get retrieves a policy.
+func (r *RedisReplica) Get(ctx context.Context, id string) (Policy, error) {
+	return r.current().Get(ctx, id)
+}
+
+// GetAll returns all policies.
+func (r *RedisReplica) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
+	return r.current().GetAll(ctx, limit, offset)
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (r *RedisReplica) FindRequestCandidates(ctx context.Context, req *Request) (Policies, error) {
+	return r.current().FindRequestCandidates(ctx, req)
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (r *RedisReplica) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	return r.current().FindCandidates(ctx, subjects, resources, actions)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (r *RedisReplica) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
+	return r.current().FindPoliciesForSubject(ctx, subject)
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (r *RedisReplica) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
+	return r.current().FindPoliciesForResource(ctx, resource)
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (r *RedisReplica) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	return r.current().FindPoliciesForResources(ctx, resources)
+}
+
+func (r *RedisReplica) current() *memory.MemoryManager {
+	return r.snapshot
+}
+
+func (r *RedisReplica) sync(ctx context.Context) {
+	err := r.Reload(ctx)
+	if r.OnSync != nil {
+		r.OnSync(err)
+	}
+}
+
+// apply applies a published change to the local snapshot.
+func (r *RedisReplica) apply(ctx context.Context, payload string) error {
+	var change Change
+	if err := json.Unmarshal([]byte(payload), &change); err != nil {
+		return errors.WithStack(err)
+	}
+	return r.refresh(ctx, change.ID)
+}
+
+// refresh copies the current version of the policy from Redis to the local snapshot. A policy which did not change,
+// for example because the replica applied its own write already, is left as it is.
+func (r *RedisReplica) refresh(ctx context.Context, id string) error {
+	record, err := r.m.get(ctx, r.m.db, id)
+	if err != nil {
+		return err
+	} else if record == nil {
+		return r.current().Delete(ctx, id)
+	} else if current, err := r.current().Get(ctx, id); err == nil && reflect.DeepEqual(current, record.Policy) {
+		return nil
+	}
+	return r.current().Update(ctx, record.Policy)
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect adapts the SQL manager to a database.
+type Dialect interface {
+	// Name returns the name of the dialect.
+	Name() string
+
+	// Rebind rewrites a query which uses ? as placeholders to the placeholders of the database.
+	Rebind(query string) string
+
+	// InsertIgnore returns a statement which inserts a row with the given columns into table unless a row with the
+	// same primary key exists already.
+	InsertIgnore(table string, columns ...string) string
+
+	// Migrations returns the schema migrations of the manager in the order in which they must be applied.
+	Migrations() []Migration
+}
+
+// Migration is a schema migration.
+type Migration struct {
+	// ID identifies the migration. Applied migrations are recorded by their ID.
+	ID string
+
+	// Up contains the statements which apply the migration.
+	Up []string
+
+	// Down contains the statements which revert the migration.
+	Down []string
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SQLiteDialect is the dialect of SQLite.
+type SQLiteDialect struct{}
+
+// Name returns the name of the dialect.
+func (d *SQLiteDialect) Name() string {
+	return "sqlite"
+}
+
+// Rebind returns the query unchanged because SQLite supports ? placeholders.
+func (d *SQLiteDialect) Rebind(query string) string {
+	return query
+}
+
+// InsertIgnore returns an INSERT OR IGNORE statement.
+func (d *SQLiteDialect) InsertIgnore(table string, columns ...string) string {
+	return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders(len(columns)))
+}
+
+// Migrations returns the schema migrations of the manager.
+func (d *SQLiteDialect) Migrations() []Migration {
+	return migrations(map[string]string{
+		"pk":   "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"blob": "BLOB",
+	})
+}
+
+// PostgresDialect is the dialect of PostgreSQL.
+type PostgresDialect struct{}
+
+// Name returns the name of the dialect.
+func (d *PostgresDialect) Name() string {
+	return "postgres"
+}
+
+// Rebind replaces the ? placeholders of the query with $1, $2 and so on.
+func (d *PostgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	var n int
+	for _, c := range query {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// InsertIgnore returns an INSERT statement which does nothing on conflicts.
+func (d *PostgresDialect) InsertIgnore(table string, columns ...string) string {
+	return d.Rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING", table, strings.Join(columns, ", "), placeholders(len(columns))))
+}
+
+// Migrations returns the schema migrations of the manager.
+func (d *PostgresDialect) Migrations() []Migration {
+	return migrations(map[string]string{
+		"pk":   "BIGSERIAL PRIMARY KEY",
+		"blob": "BYTEA",
+	})
+}
+
+// MySQLDialect is the dialect of MySQL.
+type MySQLDialect struct{}
+
+// Name returns the name of the dialect.
+func (d *MySQLDialect) Name() string {
+	return "mysql"
+}
+
+// Rebind returns the query unchanged because MySQL supports ? placeholders.
+func (d *MySQLDialect) Rebind(query string) string {
+	return query
+}
+
+// InsertIgnore returns an INSERT IGNORE statement.
+func (d *MySQLDialect) InsertIgnore(table string, columns ...string) string {
+	return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders(len(columns)))
+}
+
+// Migrations returns the schema migrations of the manager.
+func (d *MySQLDialect) Migrations() []Migration {
+	ms := migrations(map[string]string{
+		"pk":   "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		"blob": "BLOB",
+	})
+	for k := range ms {
+		for i, stmt := range ms[k].Up {
+			if strings.HasPrefix(stmt, "CREATE TABLE") {
+				ms[k].Up[i] = stmt + " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+			}
+		}
+	}
+	return ms
+}
+
+// migrations returns the schema migrations with the dialect specific types filled in.
+func migrations(types map[string]string) []Migration {
+	r := strings.NewReplacer("{{pk}}", types["pk"], "{{blob}}", types["blob"])
+
+	var ms []Migration
+	for _, m := range schema {
+		up := make([]string, len(m.Up))
+		for k, stmt := range m.Up {
+			up[k] = r.Replace(stmt)
+		}
+		ms = append(ms, Migration{ID: m.ID, Up: up, Down: m.Down})
+	}
+	return ms
+}
+
+// schema contains the schema migrations. {{pk}} and {{blob}} are replaced with the dialect's auto incrementing
+// primary key and binary types.
+var schema = []Migration{
+	{
+		ID: "1",
+		Up: []string{
+			`CREATE TABLE ladon_policy (
+	pk {{pk}},
+	id VARCHAR(255) NOT NULL UNIQUE,
+	description TEXT NOT NULL,
+	effect VARCHAR(255) NOT NULL,
+	conditions TEXT NOT NULL,
+	meta {{blob}},
+	priority INTEGER NOT NULL,
+	not_subjects TEXT NOT NULL,
+	not_resources TEXT NOT NULL,
+	not_actions TEXT NOT NULL,
+	obligations TEXT NOT NULL,
+	advice TEXT NOT NULL
+)`,
+			`CREATE TABLE ladon_subject (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	template TEXT NOT NULL,
+	has_pattern SMALLINT NOT NULL
+)`,
+			`CREATE TABLE ladon_resource (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	template TEXT NOT NULL,
+	has_pattern SMALLINT NOT NULL
+)`,
+			`CREATE TABLE ladon_action (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	template TEXT NOT NULL,
+	has_pattern SMALLINT NOT NULL
+)`,
+			`CREATE TABLE ladon_policy_subject_rel (
+	policy VARCHAR(255) NOT NULL,
+	subject VARCHAR(64) NOT NULL,
+	seq INTEGER NOT NULL,
+	PRIMARY KEY (policy, seq)
+)`,
+			`CREATE TABLE ladon_policy_resource_rel (
+	policy VARCHAR(255) NOT NULL,
+	resource VARCHAR(64) NOT NULL,
+	seq INTEGER NOT NULL,
+	PRIMARY KEY (policy, seq)
+)`,
+			`CREATE TABLE ladon_policy_action_rel (
+	policy VARCHAR(255) NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	seq INTEGER NOT NULL,
+	PRIMARY KEY (policy, seq)
+)`,
+			`CREATE INDEX ladon_subject_has_pattern_idx ON ladon_subject (has_pattern)`,
+			`CREATE INDEX ladon_resource_has_pattern_idx ON ladon_resource (has_pattern)`,
+			`CREATE INDEX ladon_action_has_pattern_idx ON ladon_action (has_pattern)`,
+			`CREATE INDEX ladon_policy_subject_rel_subject_idx ON ladon_policy_subject_rel (subject)`,
+			`CREATE INDEX ladon_policy_resource_rel_resource_idx ON ladon_policy_resource_rel (resource)`,
+			`CREATE INDEX ladon_policy_action_rel_action_idx ON ladon_policy_action_rel (action)`,
+		},
+		Down: []string{
+			`DROP TABLE ladon_policy_action_rel`,
+			`DROP TABLE ladon_policy_resource_rel`,
+			`DROP TABLE ladon_policy_subject_rel`,
+			`DROP TABLE ladon_action`,
+			`DROP TABLE ladon_resource`,
+			`DROP TABLE ladon_subject`,
+			`DROP TABLE ladon_policy`,
+		},
+	},
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package sql
+
+import (
+	"context"
+
+	. "github.com/ory/ladon"
+)
+
+// SQLManagerMigrator implements ManagerMigrator for the SQLManager.
+type SQLManagerMigrator struct {
+	Manager *SQLManager
+}
+
+// NewSQLManagerMigrator initializes a new SQLManagerMigrator.
+func NewSQLManagerMigrator(m *SQLManager) *SQLManagerMigrator {
+	return &SQLManagerMigrator{
+		Manager: m,
+	}
+}
+
+// GetManager returns the SQLManager.
+func (m *SQLManagerMigrator) GetManager() Manager {
+	return m.Manager
+}
+
+// Create persists the policy.
+func (m *SQLManagerMigrator) Create(policy Policy) error {
+	return m.Manager.Create(context.Background(), policy)
+}
+
+// Migrate applies all pending schema migrations.
+func (m *SQLManagerMigrator) Migrate() error {
+	_, err := m.Manager.CreateSchemas(context.Background())
+	return err
+}
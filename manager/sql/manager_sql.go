@@ -0,0 +1,487 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package sql implements a ladon.Manager which stores policies in a SQL database using database/sql.
+//
+// Subjects, resources and actions are stored uniquely in separate tables which are related to the policies. When
+// looking up request candidates, items without regular expressions are filtered in SQL by exact match while items
+// with regular expressions or policy variables are always returned and matched by the warden.
+//
+// Reads run in read-only transactions and can use their own database handle, see NewSQLManagerWithReader.
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// maxParameters is the maximum number of parameters used in a single IN clause.
+const maxParameters = 500
+
+// relations lists the kinds of items which are stored in their own tables.
+var relations = []string{"subject", "resource", "action"}
+
+// SQLManager is a SQL implementation of Manager.
+type SQLManager struct {
+	db      *sql.DB
+	reader  *sql.DB
+	dialect Dialect
+}
+
+// NewSQLManager initializes a new SQLManager for the given database and dialect which reads and writes through db,
+// see NewSQLManagerWithReader. Call CreateSchemas before using the manager.
+func NewSQLManager(db *sql.DB, dialect Dialect) *SQLManager {
+	return NewSQLManagerWithReader(db, db, dialect)
+}
+
+// NewSQLManagerWithReader initializes a new SQLManager which writes through db and reads through reader. Both must
+// connect to the same database. Reads run in read-only transactions, writes in read-write transactions.
+//
+// This allows to configure reads and writes differently. For example, a SQLite database should be opened for writing
+// with _txlock=immediate, so that concurrent writers wait for each other instead of failing. The reader must not use
+// that option, because every read would then take the write lock and authorization checks could no longer run
+// concurrently. Call CreateSchemas before using the manager.
+func NewSQLManagerWithReader(db *sql.DB, reader *sql.DB, dialect Dialect) *SQLManager {
+	return &SQLManager{
+		db:      db,
+		reader:  reader,
+		dialect: dialect,
+	}
+}
+
+// CreateSchemas applies all schema migrations which have not been applied yet and returns their number.
+func (m *SQLManager) CreateSchemas(ctx context.Context) (int, error) {
+	if _, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS ladon_migration (id VARCHAR(255) NOT NULL PRIMARY KEY)"); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var applied int
+	for _, migration := range m.dialect.Migrations() {
+		var count int
+		if err := m.db.QueryRowContext(ctx, m.rebind("SELECT COUNT(*) FROM ladon_migration WHERE id = ?"), migration.ID).Scan(&count); err != nil {
+			return applied, errors.WithStack(err)
+		} else if count > 0 {
+			continue
+		}
+
+		if err := m.transaction(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range migration.Up {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return errors.Wrapf(err, "Could not apply migration %s", migration.ID)
+				}
+			}
+			_, err := tx.ExecContext(ctx, m.rebind("INSERT INTO ladon_migration (id) VALUES (?)"), migration.ID)
+			return errors.WithStack(err)
+		}); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Create persists the policy.
+func (m *SQLManager) Create(ctx context.Context, policy Policy) error {
+	return m.transaction(ctx, func(tx *sql.Tx) error {
+		if exists, err := m.exists(ctx, tx, policy.GetID()); err != nil {
+			return err
+		} else if exists {
+			return errors.New("Policy exists")
+		}
+		return m.create(ctx, tx, policy)
+	})
+}
+
+// Update updates an existing policy. If the policy does not exist, it is created.
+func (m *SQLManager) Update(ctx context.Context, policy Policy) error {
+	return m.transaction(ctx, func(tx *sql.Tx) error {
+		if exists, err := m.exists(ctx, tx, policy.GetID()); err != nil {
+			return err
+		} else if !exists {
+			return m.create(ctx, tx, policy)
+		}
+
+		if err := m.deleteRelations(ctx, tx, policy.GetID()); err != nil {
+			return err
+		}
+
+		values, err := policyValues(policy)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, m.rebind(`UPDATE ladon_policy SET description = ?, effect = ?, conditions = ?, meta = ?,
+	priority = ?, not_subjects = ?, not_resources = ?, not_actions = ?, obligations = ?, advice = ? WHERE id = ?`),
+			append(values[1:], policy.GetID())...); err != nil {
+			return errors.WithStack(err)
+		}
+		return m.createRelations(ctx, tx, policy)
+	})
+}
+
+// Get retrieves a policy.
+func (m *SQLManager) Get(ctx context.Context, id string) (Policy, error) {
+	policies, err := m.findPolicies(ctx, "p.id = ?", "", id)
+	if err != nil {
+		return nil, err
+	} else if len(policies) == 0 {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return policies[0], nil
+}
+
+// Delete removes a policy.
+func (m *SQLManager) Delete(ctx context.Context, id string) error {
+	return m.transaction(ctx, func(tx *sql.Tx) error {
+		if err := m.deleteRelations(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, m.rebind("DELETE FROM ladon_policy WHERE id = ?"), id)
+		return errors.WithStack(err)
+	})
+}
+
+// GetAll retrieves all policies ordered by their ID.
+func (m *SQLManager) GetAll(ctx context.Context, limit, offset int64) (Policies, error) {
+	return m.findPolicies(ctx, "1 = 1", "ORDER BY p.id LIMIT ? OFFSET ?", limit, offset)
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *SQLManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	return m.FindCandidates(ctx, []string{r.Subject}, []string{r.Resource}, []string{r.Action})
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *SQLManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	if len(subjects) == 0 || len(resources) == 0 || len(actions) == 0 {
+		return Policies{}, nil
+	}
+
+	subjectFilter, subjectArgs := candidateFilter("subject", subjects)
+	resourceFilter, resourceArgs := candidateFilter("resource", resources)
+	actionFilter, actionArgs := candidateFilter("action", actions)
+
+	args := append(append(subjectArgs, resourceArgs...), actionArgs...)
+	return m.findPolicies(ctx, subjectFilter+" AND "+resourceFilter+" AND "+actionFilter, "", args...)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *SQLManager) FindPoliciesForSubject(ctx context.Context, subject string) (Policies, error) {
+	where, args := candidateFilter("subject", []string{subject})
+	return m.findPolicies(ctx, where, "", args...)
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *SQLManager) FindPoliciesForResource(ctx context.Context, resource string) (Policies, error) {
+	return m.FindPoliciesForResources(ctx, []string{resource})
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+// a set of policies that apply to the resources, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *SQLManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	where, args := candidateFilter("resource", resources)
+	return m.findPolicies(ctx, where, "", args...)
+}
+
+func (m *SQLManager) rebind(query string) string {
+	return m.dialect.Rebind(query)
+}
+
+// transaction runs f in a read-write transaction on the writer.
+func (m *SQLManager) transaction(ctx context.Context, f func(tx *sql.Tx) error) error {
+	return run(ctx, m.db, nil, f)
+}
+
+// readTransaction runs f in a read-only transaction on the reader.
+func (m *SQLManager) readTransaction(ctx context.Context, f func(tx *sql.Tx) error) error {
+	return run(ctx, m.reader, &sql.TxOptions{ReadOnly: true}, f)
+}
+
+func run(ctx context.Context, db *sql.DB, opts *sql.TxOptions, f func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return errors.Wrap(err, rerr.Error())
+		}
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (m *SQLManager) exists(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+	var count int
+	if err := tx.QueryRowContext(ctx, m.rebind("SELECT COUNT(*) FROM ladon_policy WHERE id = ?"), id).Scan(&count); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return count > 0, nil
+}
+
+func (m *SQLManager) create(ctx context.Context, tx *sql.Tx, policy Policy) error {
+	values, err := policyValues(policy)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.rebind(`INSERT INTO ladon_policy (id, description, effect, conditions, meta, priority,
+	not_subjects, not_resources, not_actions, obligations, advice) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return m.createRelations(ctx, tx, policy)
+}
+
+func (m *SQLManager) createRelations(ctx context.Context, tx *sql.Tx, policy Policy) error {
+	for _, relation := range relations {
+		var items []string
+		switch relation {
+		case "subject":
+			items = policy.GetSubjects()
+		case "resource":
+			items = policy.GetResources()
+		case "action":
+			items = policy.GetActions()
+		}
+
+		for seq, item := range items {
+			id := hash(item)
+			pattern := 0
+			if hasPattern(policy, item) {
+				pattern = 1
+			}
+
+			if _, err := tx.ExecContext(ctx, m.dialect.InsertIgnore("ladon_"+relation, "id", "template", "has_pattern"), id, item, pattern); err != nil {
+				return errors.WithStack(err)
+			}
+
+			// Templates are shared between policies. If another policy stored the template without a pattern, it
+			// must be looked up as a pattern from now on.
+			if pattern == 1 {
+				if _, err := tx.ExecContext(ctx, m.rebind(fmt.Sprintf("UPDATE ladon_%s SET has_pattern = 1 WHERE id = ? AND has_pattern = 0", relation)), id); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, m.rebind(fmt.Sprintf("INSERT INTO ladon_policy_%[1]s_rel (policy, %[1]s, seq) VALUES (?, ?, ?)", relation)), policy.GetID(), id, seq); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *SQLManager) deleteRelations(ctx context.Context, tx *sql.Tx, id string) error {
+	for _, relation := range relations {
+		if _, err := tx.ExecContext(ctx, m.rebind(fmt.Sprintf("DELETE FROM ladon_policy_%s_rel WHERE policy = ?", relation)), id); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// findPolicies returns the policies matching the where clause, ordered by their creation or by suffix.
+func (m *SQLManager) findPolicies(ctx context.Context, where string, suffix string, args ...interface{}) (Policies, error) {
+	if suffix == "" {
+		suffix = "ORDER BY p.pk"
+	}
+
+	var policies Policies
+	err := m.readTransaction(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, m.rebind(`SELECT p.id, p.description, p.effect, p.conditions, p.meta, p.priority,
+	p.not_subjects, p.not_resources, p.not_actions, p.obligations, p.advice FROM ladon_policy p WHERE `+where+" "+suffix), args...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer rows.Close()
+
+		byID := map[string]*DefaultPolicy{}
+		for rows.Next() {
+			p, err := scanPolicy(rows)
+			if err != nil {
+				return err
+			}
+			policies = append(policies, p)
+			byID[p.ID] = p
+		}
+		if err := rows.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		rows.Close()
+
+		ids := make([]interface{}, len(policies))
+		for k, p := range policies {
+			ids[k] = p.GetID()
+		}
+		return m.loadRelations(ctx, tx, byID, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// loadRelations loads the subjects, resources and actions of the given policies.
+func (m *SQLManager) loadRelations(ctx context.Context, tx *sql.Tx, policies map[string]*DefaultPolicy, ids []interface{}) error {
+	for start := 0; start < len(ids); start += maxParameters {
+		end := start + maxParameters
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		for _, relation := range relations {
+			rows, err := tx.QueryContext(ctx, m.rebind(fmt.Sprintf(`SELECT r.policy, t.template FROM ladon_policy_%[1]s_rel r
+	JOIN ladon_%[1]s t ON t.id = r.%[1]s WHERE r.policy IN (%[2]s) ORDER BY r.policy, r.seq`, relation, placeholders(end-start))), ids[start:end]...)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			for rows.Next() {
+				var id, template string
+				if err := rows.Scan(&id, &template); err != nil {
+					rows.Close()
+					return errors.WithStack(err)
+				}
+
+				p := policies[id]
+				switch relation {
+				case "subject":
+					p.Subjects = append(p.Subjects, template)
+				case "resource":
+					p.Resources = append(p.Resources, template)
+				case "action":
+					p.Actions = append(p.Actions, template)
+				}
+			}
+
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// candidateFilter returns a where clause which matches policies with an item of the given relation that might match
+// one of the needles.
+func candidateFilter(relation string, needles []string) (string, []interface{}) {
+	args := make([]interface{}, len(needles))
+	for k, needle := range needles {
+		args[k] = hash(needle)
+	}
+
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM ladon_policy_%[1]s_rel r JOIN ladon_%[1]s t ON t.id = r.%[1]s
+	WHERE r.policy = p.id AND (t.has_pattern = 1 OR t.id IN (%[2]s)))`, relation, placeholders(len(needles))), args
+}
+
+// hash returns the ID of a subject, resource or action template.
+func hash(template string) string {
+	sum := sha256.Sum256([]byte(template))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasPattern returns true if the item contains a regular expression or a policy variable and therefore can not be
+// matched exactly, see IndexPrefix.
+func hasPattern(p Policy, item string) bool {
+	_, exact := IndexPrefix(p, item)
+	return !exact
+}
+
+// policyValues returns the column values of the policy in the order id, description, effect, conditions, meta,
+// priority, not_subjects, not_resources, not_actions, obligations and advice.
+func policyValues(p Policy) ([]interface{}, error) {
+	var notSubjects, notResources, notActions []string
+	if ep, ok := p.(ExclusionPolicy); ok {
+		notSubjects, notResources, notActions = ep.GetNotSubjects(), ep.GetNotResources(), ep.GetNotActions()
+	}
+
+	var obligations, advice Obligations
+	if op, ok := p.(ObligationPolicy); ok {
+		obligations, advice = op.GetObligations(), op.GetAdvice()
+	}
+
+	columns := make([]string, 6)
+	for k, v := range []interface{}{p.GetConditions(), notSubjects, notResources, notActions, obligations, advice} {
+		out, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		columns[k] = string(out)
+	}
+
+	return []interface{}{
+		p.GetID(), p.GetDescription(), p.GetEffect(), columns[0], p.GetMeta(), GetPolicyPriority(p),
+		columns[1], columns[2], columns[3], columns[4], columns[5],
+	}, nil
+}
+
+func scanPolicy(rows *sql.Rows) (*DefaultPolicy, error) {
+	var p DefaultPolicy
+	var conditions, notSubjects, notResources, notActions, obligations, advice string
+	if err := rows.Scan(&p.ID, &p.Description, &p.Effect, &conditions, &p.Meta, &p.Priority,
+		&notSubjects, &notResources, &notActions, &obligations, &advice); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p.Conditions = Conditions{}
+	if err := json.Unmarshal([]byte(conditions), &p.Conditions); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, column := range []struct {
+		src string
+		dst interface{}
+	}{
+		{src: notSubjects, dst: &p.NotSubjects},
+		{src: notResources, dst: &p.NotResources},
+		{src: notActions, dst: &p.NotActions},
+		{src: obligations, dst: &p.Obligations},
+		{src: advice, dst: &p.Advice},
+	} {
+		// Empty values are stored as null or as an empty object and are restored as nil.
+		if column.src == "null" || column.src == "{}" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(column.src), column.dst); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return &p, nil
+}
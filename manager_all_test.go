@@ -21,43 +21,119 @@
 package ladon_test
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/mattn/go-sqlite3"
+	bbolt "go.etcd.io/bbolt"
+
 	. "github.com/ory/ladon"
+	"github.com/ory/ladon/ladontest"
+	. "github.com/ory/ladon/manager/bolt"
 	. "github.com/ory/ladon/manager/memory"
+	ladonredis "github.com/ory/ladon/manager/redis"
+	ladonsql "github.com/ory/ladon/manager/sql"
 )
 
-var managers = map[string]Manager{}
+// managers returns new, empty instances of every manager.
+var managers = map[string]func(t testing.TB) Manager{
+	"memory": func(t testing.TB) Manager {
+		return NewMemoryManager()
+	},
+	"sqlite": func(t testing.TB) Manager {
+		return newSQLiteManager(t)
+	},
+	"bolt": func(t testing.TB) Manager {
+		return newBoltManager(t)
+	},
+	"redis": func(t testing.TB) Manager {
+		return newRedisManager(t)
+	},
+	"versioned memory": func(t testing.TB) Manager {
+		return NewVersionedManager(NewMemoryManager(), nil)
+	},
+	"cached memory": func(t testing.TB) Manager {
+		m := NewMemoryManager()
+		return NewCachedWarden(&Ladon{Manager: m}, m, CacheConfig{}).Manager()
+	},
+	"redis replica": func(t testing.TB) Manager {
+		replica, err := ladonredis.NewRedisReplica(context.Background(), newRedisManager(t))
+		if err != nil {
+			t.Fatalf("Could not create redis replica: %s", err)
+		}
+		return replica
+	},
+}
 
 func TestMain(m *testing.M) {
-	connectMEM()
+	os.Exit(m.Run())
 }
 
-func connectMEM() {
-	managers["memory"] = NewMemoryManager()
+// newBoltManager returns a BoltManager backed by a fresh database in a temporary directory.
+func newBoltManager(t testing.TB) *BoltManager {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "ladon.db"), 0o600, nil)
+	if err != nil {
+		t.Fatalf("Could not open bolt database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewBoltManager(db)
+	if err != nil {
+		t.Fatalf("Could not create bolt manager: %s", err)
+	}
+	return m
 }
 
-func TestManagers(t *testing.T) {
-	t.Run("type=get errors", func(t *testing.T) {
-		for k, s := range managers {
-			t.Run("manager="+k, HelperTestGetErrors(s))
-		}
-	})
+// newRedisManager returns a RedisManager backed by a fresh in-process Redis server.
+func newRedisManager(t testing.TB) *ladonredis.RedisManager {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Could not start redis: %s", err)
+	}
+	t.Cleanup(s.Close)
 
-	t.Run("type=CRUD", func(t *testing.T) {
-		for k, s := range managers {
-			t.Run(fmt.Sprintf("manager=%s", k), HelperTestCreateGetDelete(s))
-		}
-	})
-
-	t.Run("type=find", func(t *testing.T) {
-		for k, s := range map[string]Manager{
-			"postgres": managers["postgres"],
-			"mysql":    managers["mysql"],
-		} {
-			t.Run(fmt.Sprintf("manager=%s", k), HelperTestFindPoliciesForSubject(k, s))
-			t.Run(fmt.Sprintf("manager=%s", k), HelperTestFindPoliciesForResource(k, s))
-		}
-	})
+	db := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { db.Close() })
+	return ladonredis.NewRedisManager(db, "")
+}
+
+// newSQLiteManager returns a SQLManager backed by a fresh SQLite database in a temporary directory.
+func newSQLiteManager(t testing.TB) *ladonsql.SQLManager {
+	path := filepath.Join(t.TempDir(), "ladon.db")
+
+	// Write transactions acquire the write lock right away, so that concurrent writers wait for each other instead of
+	// failing. Read transactions only take a shared lock.
+	db := openSQLite(t, path+"?_foreign_keys=on&_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate")
+	reader := openSQLite(t, path+"?_busy_timeout=10000&_journal_mode=WAL")
+
+	m := ladonsql.NewSQLManagerWithReader(db, reader, &ladonsql.SQLiteDialect{})
+	if _, err := m.CreateSchemas(context.Background()); err != nil {
+		t.Fatalf("Could not create schemas: %s", err)
+	}
+	return m
+}
+
+func openSQLite(t testing.TB, dsn string) *sql.DB {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Could not open SQLite database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestManagers(t *testing.T) {
+	for k, newManager := range managers {
+		newManager := newManager
+		t.Run("manager="+k, func(t *testing.T) {
+			ladontest.RunManagerTests(t, func(t *testing.T) Manager {
+				return newManager(t)
+			})
+		})
+	}
 }
@@ -0,0 +1,153 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bbolt "go.etcd.io/bbolt"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/bolt"
+)
+
+func TestBoltManagerPersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ladon.db")
+
+	db, err := bbolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	m, err := NewBoltManager(db)
+	require.NoError(t, err)
+
+	expected := &DefaultPolicy{
+		ID:          "protected",
+		Subjects:    []string{"<.*>"},
+		Effect:      DenyAccess,
+		Resources:   []string{"articles:1"},
+		Actions:     []string{"delete"},
+		Conditions:  Conditions{"owner": &EqualsSubjectCondition{}},
+		Priority:    10,
+		NotSubjects: []string{"admin"},
+		Obligations: Obligations{"redact": &RedactObligation{Fields: []string{"email"}}},
+	}
+	require.NoError(t, m.Create(ctx, expected))
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "deleted", Subjects: []string{"peter"}, Resources: []string{"articles:1"}}))
+	require.NoError(t, m.Delete(ctx, "deleted"))
+	require.NoError(t, db.Close())
+
+	db, err = bbolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	m, err = NewBoltManager(db)
+	require.NoError(t, err)
+
+	got, err := m.Get(ctx, "protected")
+	require.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	_, err = m.Get(ctx, "deleted")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	policies, err := m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "delete", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"protected"}, policyIDs(policies))
+}
+
+func TestBoltManagerCandidates(t *testing.T) {
+	ctx := context.Background()
+	m := newBoltManager(t)
+
+	articles := &DefaultPolicy{ID: "articles", Subjects: []string{"peter", "<max|ken>"}, Actions: []string{"view", "update"}, Resources: []string{"articles:<[0-9]+>"}}
+	own := &DefaultPolicy{ID: "own", Subjects: []string{"<.*>"}, Actions: []string{"update"}, Resources: []string{"users:${subject}"}}
+	exact := &DefaultPolicy{ID: "exact", Subjects: []string{"peter"}, Actions: []string{"delete"}, Resources: []string{"articles:1"}}
+	for _, p := range []Policy{articles, own, exact} {
+		require.NoError(t, m.Create(ctx, p))
+	}
+
+	for _, c := range []struct {
+		r        *Request
+		expected []string
+	}{
+		{r: &Request{Subject: "peter", Resource: "articles:1"}, expected: []string{"articles", "exact"}},
+		{r: &Request{Subject: "max", Resource: "articles:1"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "peter", Resource: "users:peter"}, expected: []string{"own"}},
+		{r: &Request{Subject: "peter", Resource: "articles:2"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "peter", Resource: "groups:1"}, expected: []string{}},
+	} {
+		policies, err := m.FindRequestCandidates(ctx, c.r)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, policyIDs(policies), "%+v", c.r)
+	}
+
+	// Updates replace the index entries and keep the creation order.
+	exact.Resources = []string{"articles:2"}
+	require.NoError(t, m.Update(ctx, exact))
+	policies, err := m.FindPoliciesForResource(ctx, "articles:2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "exact"}, policyIDs(policies))
+	policies, err = m.FindPoliciesForResource(ctx, "articles:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles"}, policyIDs(policies))
+}
+
+func TestBoltManagerGetAllConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	m := newBoltManager(t)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: fmt.Sprintf("b-%03d", i)}))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, m.Create(ctx, &DefaultPolicy{ID: fmt.Sprintf("c-%03d", i)}))
+		}
+	}()
+
+	// Policies created concurrently sort after the existing ones, so the pages of those never change.
+	var ids []string
+	for offset := int64(0); offset < 100; offset += 10 {
+		policies, err := m.GetAll(ctx, 10, offset)
+		require.NoError(t, err)
+		require.Len(t, policies, 10)
+		ids = append(ids, policyIDs(policies)...)
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		assert.Equal(t, fmt.Sprintf("b-%03d", i), id)
+	}
+
+	policies, err := m.GetAll(ctx, 1000, 0)
+	require.NoError(t, err)
+	assert.Len(t, policies, 200)
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/file"
+)
+
+func writePolicyFile(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestFileManager(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writePolicyFile(t, dir, "articles.json", `{
+	"id": "articles",
+	"subjects": ["peter", "<max|ken>"],
+	"actions": ["view"],
+	"resources": ["articles:<[0-9]+>"],
+	"effect": "allow",
+	"conditions": {"owner": {"type": "EqualsSubjectCondition"}}
+}`)
+	writePolicyFile(t, dir, "teams/admins.yaml", `
+- id: admins
+  subjects: [admin]
+  actions: ["<.*>"]
+  resources: ["<.*>"]
+  effect: allow
+- id: protected
+  subjects: ["<.*>"]
+  actions: [delete]
+  resources: ["articles:1"]
+  effect: deny
+  priority: 10
+`)
+	writePolicyFile(t, dir, "README.md", "not a policy")
+	writePolicyFile(t, dir, ".git/config.json", "not a policy")
+
+	m, err := NewFileManager(dir, Config{})
+	require.NoError(t, err)
+
+	policies, err := m.GetAll(ctx, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admins", "articles", "protected"}, policyIDs(policies))
+
+	p, err := m.Get(ctx, "articles")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "<max|ken>"}, p.GetSubjects())
+	assert.Equal(t, &EqualsSubjectCondition{}, p.GetConditions()["owner"])
+
+	p, err = m.Get(ctx, "protected")
+	require.NoError(t, err)
+	assert.Equal(t, 10, GetPolicyPriority(p))
+
+	policies, err = m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles"}, policyIDs(policies))
+
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Create(ctx, &DefaultPolicy{ID: "1"})))
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Update(ctx, &DefaultPolicy{ID: "1"})))
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Delete(ctx, "articles")))
+
+	warden := &Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"owner": "peter"}}))
+	assert.Error(t, warden.IsAllowed(ctx, &Request{Subject: "admin", Action: "delete", Resource: "articles:1"}))
+}
+
+func TestFileManagerValidation(t *testing.T) {
+	for k, c := range []struct {
+		name    string
+		content string
+	}{
+		{name: "syntax.json", content: `{"id": "1",`},
+		{name: "id.json", content: `{"effect": "allow"}`},
+		{name: "effect.yml", content: "id: 1\neffect: permit\n"},
+		{name: "regex.json", content: `{"id": "1", "effect": "allow", "resources": ["<[>"]}`},
+		{name: "condition.json", content: `{"id": "1", "effect": "allow", "conditions": {"foo": {"type": "UnknownCondition"}}}`},
+		{name: "duplicate.json", content: `[{"id": "1", "effect": "allow"}, {"id": "1", "effect": "deny"}]`},
+	} {
+		dir := t.TempDir()
+		writePolicyFile(t, dir, c.name, c.content)
+
+		_, err := NewFileManager(dir, Config{})
+		require.Error(t, err, "%d", k)
+		assert.Contains(t, err.Error(), c.name, "%d", k)
+	}
+}
+
+func TestFileManagerRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	writePolicyFile(t, dir, "policies.json", `[{"id": "1", "effect": "allow"}]`)
+
+	reloads := make(chan ReloadResult, 10)
+	m, err := NewFileManager(dir, Config{
+		PollInterval: time.Millisecond * 10,
+		OnReload:     func(r ReloadResult) { reloads <- r },
+	})
+	require.NoError(t, err)
+
+	events, err := m.Watch(ctx, "")
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	next := func() ReloadResult {
+		select {
+		case r := <-reloads:
+			return r
+		case <-time.After(time.Second * 5):
+			t.Fatal("Policies were not reloaded")
+		}
+		return ReloadResult{}
+	}
+
+	// A bad edit keeps the last good policies.
+	writePolicyFile(t, dir, "policies.json", `[{"id": "1", "effect": "allow"}, {"id": "2"}]`)
+	r := next()
+	require.Error(t, r.Err)
+	assert.Equal(t, []string{"policies.json"}, r.Files)
+	assert.Equal(t, 1, r.Policies)
+	_, err = m.Get(ctx, "1")
+	assert.NoError(t, err)
+
+	writePolicyFile(t, dir, "policies.json", `[{"id": "2", "effect": "allow"}, {"id": "3", "effect": "deny"}]`)
+	r = next()
+	require.NoError(t, r.Err)
+	assert.Equal(t, 2, r.Policies)
+	_, err = m.Get(ctx, "1")
+	assert.Error(t, err)
+	_, err = m.Get(ctx, "3")
+	assert.NoError(t, err)
+
+	// Watchers see the differences of successful reloads only.
+	var changes []string
+	for len(changes) < 3 {
+		select {
+		case e := <-events:
+			changes = append(changes, string(e.Type)+" "+e.ID)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Missing changes after %v", changes)
+		}
+	}
+	assert.Equal(t, []string{"delete 1", "create 2", "create 3"}, changes)
+
+	// Policies which did not change are not reported.
+	writePolicyFile(t, dir, "policies.json", `[{"id": "2", "effect": "allow"}, {"id": "3", "effect": "allow"}]`)
+	require.NoError(t, next().Err)
+	select {
+	case e := <-events:
+		assert.Equal(t, PolicyUpdated, e.Type)
+		assert.Equal(t, "3", e.ID)
+		assert.Equal(t, DenyAccess, e.Old.GetEffect())
+		assert.Equal(t, AllowAccess, e.New.GetEffect())
+	case <-time.After(time.Second * 5):
+		t.Fatal("The update was not reported")
+	}
+
+	// Unchanged files are not reloaded.
+	select {
+	case r := <-reloads:
+		t.Fatalf("Unexpected reload: %+v", r)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func policyIDs(policies Policies) []string {
+	ids := make([]string, len(policies))
+	for k, p := range policies {
+		ids[k] = p.GetID()
+	}
+	return ids
+}
+
+func TestMemoryManagerIndex(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+
+	articles := &DefaultPolicy{ID: "articles", Subjects: []string{"peter", "<max|ken>"}, Actions: []string{"view", "update"}, Resources: []string{"articles:<[0-9]+>"}}
+	own := &DefaultPolicy{ID: "own", Subjects: []string{"<.*>"}, Actions: []string{"update"}, Resources: []string{"users:${subject}"}}
+	exact := &DefaultPolicy{ID: "exact", Subjects: []string{"peter"}, Actions: []string{"delete"}, Resources: []string{"articles:1"}}
+	empty := &DefaultPolicy{ID: "empty", Subjects: []string{}, Actions: []string{"view"}, Resources: []string{"<.*>"}}
+	for _, p := range []Policy{articles, own, exact, empty} {
+		require.NoError(t, m.Create(ctx, p))
+	}
+
+	for _, c := range []struct {
+		r        *Request
+		expected []string
+	}{
+		{r: &Request{Subject: "peter", Action: "view", Resource: "articles:1"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "max", Action: "view", Resource: "articles:1"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}, expected: []string{"exact"}},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "users:peter"}, expected: []string{"own"}},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:1"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "users:peter"}, expected: []string{}},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:2"}, expected: []string{}},
+	} {
+		policies, err := m.FindRequestCandidates(ctx, c.r)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, policyIDs(policies), "%+v", c.r)
+	}
+
+	policies, err := m.FindPoliciesForSubject(ctx, "peter")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "own", "exact"}, policyIDs(policies))
+
+	policies, err = m.FindPoliciesForResource(ctx, "articles:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "exact", "empty"}, policyIDs(policies))
+
+	policies, err = m.FindPoliciesForResources(ctx, []string{"users:1", "articles:2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "own", "empty"}, policyIDs(policies))
+
+	// Updates replace the indexed items even if the policy was modified in place.
+	exact.Resources = []string{"articles:2"}
+	require.NoError(t, m.Update(ctx, exact))
+	policies, err = m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "delete", Resource: "articles:2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exact"}, policyIDs(policies))
+	policies, err = m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "delete", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	require.NoError(t, m.Delete(ctx, "articles"))
+	policies, err = m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	// Policies added to the map directly are indexed as well.
+	m.Lock()
+	m.Policies["direct"] = &DefaultPolicy{ID: "direct", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}}
+	m.Unlock()
+	policies, err = m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"direct"}, policyIDs(policies))
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/redis"
+)
+
+func TestRedisManager(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	db := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	m := NewRedisManager(db, "")
+
+	pubsub := db.Subscribe(ctx, m.Channel())
+	defer pubsub.Close()
+	_, err := pubsub.Receive(ctx)
+	require.NoError(t, err)
+
+	expected := &DefaultPolicy{
+		ID:          "protected",
+		Subjects:    []string{"<.*>"},
+		Effect:      DenyAccess,
+		Resources:   []string{"articles:1"},
+		Actions:     []string{"delete"},
+		Conditions:  Conditions{"owner": &EqualsSubjectCondition{}},
+		Priority:    10,
+		NotSubjects: []string{"admin"},
+		Obligations: Obligations{"redact": &RedactObligation{Fields: []string{"email"}}},
+	}
+	require.NoError(t, m.Create(ctx, expected))
+	assert.Error(t, m.Create(ctx, expected))
+	require.NoError(t, m.Update(ctx, expected))
+	require.NoError(t, m.Delete(ctx, "protected"))
+	require.NoError(t, m.Delete(ctx, "protected"))
+
+	// Failed writes and deletes of missing policies are not published.
+	for _, expected := range []Change{
+		{Type: PolicyCreated, ID: "protected"},
+		{Type: PolicyUpdated, ID: "protected"},
+		{Type: PolicyDeleted, ID: "protected"},
+	} {
+		message, err := pubsub.ReceiveMessage(ctx)
+		require.NoError(t, err)
+
+		var change Change
+		require.NoError(t, json.Unmarshal([]byte(message.Payload), &change))
+		assert.Equal(t, expected, change)
+	}
+
+	require.NoError(t, m.Update(ctx, expected))
+	got, err := m.Get(ctx, "protected")
+	require.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "articles", Subjects: []string{"peter"}, Resources: []string{"articles:<[0-9]+>"}}))
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "users", Subjects: []string{"peter"}, Resources: []string{"users:${subject}"}}))
+	for _, c := range []struct {
+		r        *Request
+		expected []string
+	}{
+		{r: &Request{Subject: "peter", Resource: "articles:1"}, expected: []string{"protected", "articles"}},
+		{r: &Request{Subject: "ken", Resource: "articles:1"}, expected: []string{"protected"}},
+		{r: &Request{Subject: "peter", Resource: "users:peter"}, expected: []string{"users"}},
+		{r: &Request{Subject: "peter", Resource: "groups:1"}, expected: []string{}},
+	} {
+		policies, err := m.FindRequestCandidates(ctx, c.r)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, policyIDs(policies), "%+v", c.r)
+	}
+
+	policies, err := m.GetAll(ctx, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"protected", "users"}, policyIDs(policies))
+}
+
+func TestRedisReplica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := miniredis.RunT(t)
+	m := NewRedisManager(redis.NewClient(&redis.Options{Addr: s.Addr()}), "policies")
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "initial", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}}))
+
+	replica, err := NewRedisReplica(ctx, m)
+	require.NoError(t, err)
+
+	events, err := replica.Watch(ctx, "")
+	require.NoError(t, err)
+
+	synced := make(chan error, 10)
+	replica.OnSync = func(err error) { synced <- err }
+	done := make(chan error)
+	go func() { done <- replica.Run(ctx) }()
+
+	// The replica reloads its snapshot once it is subscribed, so changes made before are not missed.
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "missed", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}}))
+	select {
+	case err := <-synced:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Replica did not sync")
+	}
+
+	eventually := func(expected []string) {
+		var ids []string
+		for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+			policies, err := replica.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+			require.NoError(t, err)
+			if ids = policyIDs(policies); assert.ObjectsAreEqual(expected, ids) {
+				return
+			}
+		}
+		assert.Equal(t, expected, ids)
+	}
+	eventually([]string{"initial", "missed"})
+
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "created", Subjects: []string{"<.*>"}, Actions: []string{"view"}, Resources: []string{"articles:<.*>"}}))
+	eventually([]string{"initial", "missed", "created"})
+
+	require.NoError(t, m.Update(ctx, &DefaultPolicy{ID: "initial", Subjects: []string{"ken"}, Actions: []string{"view"}, Resources: []string{"articles:1"}}))
+	eventually([]string{"missed", "created"})
+
+	require.NoError(t, m.Delete(ctx, "missed"))
+	eventually([]string{"created"})
+
+	// Writes through the replica are visible immediately.
+	require.NoError(t, replica.Create(ctx, &DefaultPolicy{ID: "local", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}}))
+	_, err = replica.Get(ctx, "local")
+	require.NoError(t, err)
+	_, err = m.Get(ctx, "local")
+	require.NoError(t, err)
+
+	require.NoError(t, replica.Delete(ctx, "local"))
+	_, err = replica.Get(ctx, "local")
+	assert.Error(t, err)
+	_, err = m.Get(ctx, "local")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	// Watchers see every change once, no matter whether it was loaded, published or written through the replica.
+	var changes []string
+	for len(changes) < 6 {
+		select {
+		case e := <-events:
+			changes = append(changes, string(e.Type)+" "+e.ID)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Missing changes after %v", changes)
+		}
+	}
+	assert.Equal(t, []string{"create missed", "create created", "update initial", "delete missed", "create local", "delete local"}, changes)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,387 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	ladonsql "github.com/ory/ladon/manager/sql"
+)
+
+func TestSQLManagerMigrate(t *testing.T) {
+	m := newSQLiteManager(t)
+
+	// newSQLiteManager already applied all migrations.
+	applied, err := m.CreateSchemas(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	migrator := ladonsql.NewSQLManagerMigrator(m)
+	require.NoError(t, migrator.Migrate())
+	require.NoError(t, migrator.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: AllowAccess}))
+
+	p, err := migrator.GetManager().Get(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter"}, p.GetSubjects())
+}
+
+func TestSQLManagerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteManager(t)
+
+	expected := &DefaultPolicy{
+		ID:           "protected",
+		Description:  "description",
+		Subjects:     []string{"<.*>", "peter"},
+		Effect:       DenyAccess,
+		Resources:    []string{"articles:<[0-9]+>"},
+		Actions:      []string{"delete", "update"},
+		Conditions:   Conditions{"owner": &EqualsSubjectCondition{}},
+		Meta:         []byte(`{"foo":"bar"}`),
+		Priority:     10,
+		NotSubjects:  []string{"admin"},
+		NotResources: []string{"articles:1"},
+		NotActions:   []string{"view"},
+		Obligations:  Obligations{"redact": &RedactObligation{Fields: []string{"email"}}},
+		Advice:       Obligations{"log": &LogObligation{Stream: "audit"}},
+	}
+	require.NoError(t, m.Create(ctx, expected))
+	assert.Error(t, m.Create(ctx, expected))
+
+	got, err := m.Get(ctx, "protected")
+	require.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	expected.Subjects = []string{"ken"}
+	expected.Obligations = nil
+	require.NoError(t, m.Update(ctx, expected))
+
+	got, err = m.Get(ctx, "protected")
+	require.NoError(t, err)
+	assert.Equal(t, expected, got)
+}
+
+func TestSQLManagerCandidates(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteManager(t)
+
+	for _, p := range []Policy{
+		&DefaultPolicy{ID: "articles", Subjects: []string{"peter", "<max|ken>"}, Actions: []string{"view", "update"}, Resources: []string{"articles:<[0-9]+>"}},
+		&DefaultPolicy{ID: "own", Subjects: []string{"<.*>"}, Actions: []string{"update"}, Resources: []string{"users:${subject}"}},
+		&DefaultPolicy{ID: "exact", Subjects: []string{"peter"}, Actions: []string{"delete"}, Resources: []string{"articles:1"}},
+		&DefaultPolicy{ID: "empty", Subjects: []string{}, Actions: []string{"view"}, Resources: []string{"<.*>"}},
+	} {
+		require.NoError(t, m.Create(ctx, p))
+	}
+
+	for _, c := range []struct {
+		r        *Request
+		expected []string
+	}{
+		{r: &Request{Subject: "peter", Action: "view", Resource: "articles:1"}, expected: []string{"articles"}},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}, expected: []string{"exact"}},
+		{r: &Request{Subject: "ken", Action: "update", Resource: "users:ken"}, expected: []string{"articles", "own"}},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:2"}, expected: []string{}},
+		{r: &Request{Subject: "peter", Action: "create", Resource: "articles:1"}, expected: []string{}},
+	} {
+		policies, err := m.FindRequestCandidates(ctx, c.r)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, policyIDs(policies), "%+v", c.r)
+	}
+
+	policies, err := m.FindPoliciesForResources(ctx, []string{"users:1", "articles:2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles", "own", "empty"}, policyIDs(policies))
+
+	policies, err = m.GetAll(ctx, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"empty", "exact"}, policyIDs(policies))
+
+	require.NoError(t, m.Delete(ctx, "articles"))
+	require.NoError(t, m.Delete(ctx, "articles"))
+	_, err = m.Get(ctx, "articles")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+}
+
+func TestSQLManagerReadsDuringWrite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ladon.db")
+	db := openSQLite(t, path+"?_busy_timeout=100&_journal_mode=WAL&_txlock=immediate")
+	reader := openSQLite(t, path+"?_busy_timeout=100&_journal_mode=WAL")
+
+	m := ladonsql.NewSQLManagerWithReader(db, reader, &ladonsql.SQLiteDialect{})
+	_, err := m.CreateSchemas(ctx)
+	require.NoError(t, err)
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: AllowAccess}))
+
+	// Reads neither wait for nor take the write lock.
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = m.Get(ctx, "1")
+	require.NoError(t, err)
+	policies, err := m.FindRequestCandidates(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles"})
+	require.NoError(t, err)
+	assert.Len(t, policies, 1)
+}
+
+func TestSQLDialects(t *testing.T) {
+	sqlite, postgres, mysql := &ladonsql.SQLiteDialect{}, &ladonsql.PostgresDialect{}, &ladonsql.MySQLDialect{}
+
+	t.Run("type=rebind", func(t *testing.T) {
+		query := "SELECT id FROM ladon_policy WHERE id = ? AND pk IN (?, ?)"
+		assert.Equal(t, query, sqlite.Rebind(query))
+		assert.Equal(t, query, mysql.Rebind(query))
+		assert.Equal(t, "SELECT id FROM ladon_policy WHERE id = $1 AND pk IN ($2, $3)", postgres.Rebind(query))
+		assert.Equal(t, "SELECT 1", postgres.Rebind("SELECT 1"))
+	})
+
+	t.Run("type=insert ignore", func(t *testing.T) {
+		assert.Equal(t, "INSERT OR IGNORE INTO ladon_subject (id, template, has_pattern) VALUES (?, ?, ?)",
+			sqlite.InsertIgnore("ladon_subject", "id", "template", "has_pattern"))
+		assert.Equal(t, "INSERT INTO ladon_subject (id, template, has_pattern) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+			postgres.InsertIgnore("ladon_subject", "id", "template", "has_pattern"))
+		assert.Equal(t, "INSERT IGNORE INTO ladon_subject (id, template, has_pattern) VALUES (?, ?, ?)",
+			mysql.InsertIgnore("ladon_subject", "id", "template", "has_pattern"))
+	})
+
+	t.Run("type=migrations", func(t *testing.T) {
+		for _, c := range []struct {
+			dialect ladonsql.Dialect
+			pk      string
+			blob    string
+			suffix  string
+		}{
+			{dialect: sqlite, pk: "pk INTEGER PRIMARY KEY AUTOINCREMENT,", blob: "meta BLOB,"},
+			{dialect: postgres, pk: "pk BIGSERIAL PRIMARY KEY,", blob: "meta BYTEA,"},
+			{dialect: mysql, pk: "pk BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,", blob: "meta BLOB,", suffix: ") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"},
+		} {
+			t.Run("dialect="+c.dialect.Name(), func(t *testing.T) {
+				migrations := c.dialect.Migrations()
+				require.Len(t, migrations, 1)
+				assert.Equal(t, "1", migrations[0].ID)
+				assert.Len(t, migrations[0].Down, 7)
+
+				var tables, indices int
+				for _, stmt := range migrations[0].Up {
+					assert.NotContains(t, stmt, "{{")
+					switch {
+					case strings.HasPrefix(stmt, "CREATE TABLE"):
+						tables++
+						if c.suffix != "" {
+							assert.True(t, strings.HasSuffix(stmt, c.suffix), stmt)
+						} else {
+							assert.True(t, strings.HasSuffix(stmt, ")"), stmt)
+						}
+					case strings.HasPrefix(stmt, "CREATE INDEX"):
+						indices++
+						assert.NotContains(t, stmt, "ENGINE=")
+					default:
+						t.Errorf("Unexpected statement %s", stmt)
+					}
+				}
+				assert.Equal(t, 7, tables)
+				assert.Equal(t, 6, indices)
+
+				policy := migrations[0].Up[0]
+				assert.True(t, strings.HasPrefix(policy, "CREATE TABLE ladon_policy ("), policy)
+				assert.Contains(t, policy, c.pk)
+				assert.Contains(t, policy, c.blob)
+
+				// The migrations are generated anew on every call.
+				assert.Equal(t, migrations, c.dialect.Migrations())
+			})
+		}
+	})
+}
+
+// recordingDriver is a database/sql driver which records all statements and their number of arguments. Queries return
+// no rows, except for counts which return 0.
+type recordingDriver struct {
+	sync.Mutex
+	statements []recordedStatement
+}
+
+type recordedStatement struct {
+	query string
+	args  int
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+func (d *recordingDriver) record(query string, args int) {
+	d.Lock()
+	defer d.Unlock()
+	d.statements = append(d.statements, recordedStatement{query: query, args: args})
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *recordingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	return nil
+}
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error {
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.driver.record(s.query, len(args))
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.driver.record(s.query, len(args))
+	if strings.HasPrefix(s.query, "SELECT COUNT(*)") {
+		return &recordingRows{columns: []string{"count"}, values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return &recordingRows{columns: make([]string, 11)}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLDialectStatements(t *testing.T) {
+	placeholders := map[string]*regexp.Regexp{
+		"postgres": regexp.MustCompile(`\$([0-9]+)`),
+		"mysql":    regexp.MustCompile(`\?`),
+	}
+
+	for _, dialect := range []ladonsql.Dialect{&ladonsql.PostgresDialect{}, &ladonsql.MySQLDialect{}} {
+		t.Run("dialect="+dialect.Name(), func(t *testing.T) {
+			ctx := context.Background()
+			d := &recordingDriver{}
+			db := sql.OpenDB(driverConnector{d})
+			defer db.Close()
+
+			m := ladonsql.NewSQLManager(db, dialect)
+			_, err := m.CreateSchemas(ctx)
+			require.NoError(t, err)
+
+			p := &DefaultPolicy{ID: "1", Subjects: []string{"peter", "<.*>"}, Actions: []string{"view"}, Resources: []string{"articles:${subject}"}, Effect: AllowAccess}
+			require.NoError(t, m.Create(ctx, p))
+			require.NoError(t, m.Update(ctx, p))
+			_, err = m.Get(ctx, "1")
+			assert.Equal(t, ErrNotFound, errors.Cause(err))
+			_, err = m.GetAll(ctx, 10, 0)
+			require.NoError(t, err)
+			_, err = m.FindCandidates(ctx, []string{"peter", "role:editor"}, []string{"articles:1", "articles"}, []string{"view"})
+			require.NoError(t, err)
+			_, err = m.FindPoliciesForSubject(ctx, "peter")
+			require.NoError(t, err)
+			require.NoError(t, m.Delete(ctx, "1"))
+
+			require.NotEmpty(t, d.statements)
+			for _, stmt := range d.statements {
+				found := placeholders[dialect.Name()].FindAllStringSubmatch(stmt.query, -1)
+				assert.Len(t, found, stmt.args, stmt.query)
+				if dialect.Name() == "postgres" {
+					assert.NotContains(t, stmt.query, "?")
+					for k, match := range found {
+						assert.Equal(t, strconv.Itoa(k+1), match[1], stmt.query)
+					}
+				} else {
+					assert.NotRegexp(t, `\$[0-9]`, stmt.query)
+				}
+			}
+		})
+	}
+}
+
+// driverConnector opens connections of a driver without registering it.
+type driverConnector struct {
+	driver driver.Driver
+}
+
+func (c driverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c driverConnector) Driver() driver.Driver {
+	return c.driver
+}
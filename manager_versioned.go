@@ -0,0 +1,445 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ChangeType describes how a policy was changed.
+type ChangeType string
+
+const (
+	PolicyCreated ChangeType = "create"
+	PolicyUpdated ChangeType = "update"
+	PolicyDeleted ChangeType = "delete"
+)
+
+// PolicyVersion is a recorded change of a policy.
+type PolicyVersion struct {
+	// ID is the ID of the policy.
+	ID string `json:"id"`
+
+	// Version numbers the changes of a policy, starting with 1.
+	Version int `json:"version"`
+
+	// Type is the kind of change.
+	Type ChangeType `json:"type"`
+
+	// Actor is the actor who made the change, see WithActor.
+	Actor string `json:"actor"`
+
+	// Time is the time of the change.
+	Time time.Time `json:"time"`
+
+	// Policy is a copy of the policy after the change, or nil if the policy was deleted.
+	Policy *DefaultPolicy `json:"policy,omitempty"`
+
+	// RestoredVersion is set if the change rolled the policy back to a previous version.
+	RestoredVersion int `json:"restored_version,omitempty"`
+}
+
+// VersionStore stores the versions recorded by a VersionedManager.
+type VersionStore interface {
+	// AddVersion stores a version.
+	AddVersion(ctx context.Context, v *PolicyVersion) error
+
+	// GetVersions returns all versions of a policy, oldest first.
+	GetVersions(ctx context.Context, id string) ([]*PolicyVersion, error)
+}
+
+type actorKey struct{}
+
+// WithActor returns a context which carries the actor who modifies policies, for example the ID of the authenticated
+// user. A VersionedManager records the actor with every change.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// VersionedManager wraps a Manager and records every Create, Update and Delete together with the time, the actor
+// taken from the context and a copy of the policy. Reads are passed to the wrapped Manager. If the wrapped Manager
+// implements RevisionManager, conditional updates and deletes are passed to it and recorded as well. Watch,
+// FindCandidates and FindPoliciesForResources are passed to the wrapped Manager if it implements Watcher,
+// MultiCandidateManager or HierarchicalResourceManager.
+//
+// Changes are recorded after the wrapped Manager accepted them. Modify policies only through the VersionedManager,
+// otherwise the history is incomplete.
+type VersionedManager struct {
+	Manager
+
+	store VersionStore
+	now   func() time.Time
+
+	// Mutex serializes writes, so that versions are recorded in the order they were applied.
+	sync.Mutex
+}
+
+// NewVersionedManager wraps the manager. Versions are kept in the store, or in memory if store is nil.
+func NewVersionedManager(m Manager, store VersionStore) *VersionedManager {
+	if store == nil {
+		store = NewMemoryVersionStore()
+	}
+	return &VersionedManager{Manager: m, store: store, now: time.Now}
+}
+
+// Create persists the policy and records its first version.
+func (m *VersionedManager) Create(ctx context.Context, policy Policy) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.Manager.Create(ctx, policy); err != nil {
+		return err
+	}
+	_, err := m.record(ctx, policy.GetID(), PolicyCreated, policy, 0)
+	return err
+}
+
+// Update updates the policy and records the new version.
+func (m *VersionedManager) Update(ctx context.Context, policy Policy) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.Manager.Update(ctx, policy); err != nil {
+		return err
+	}
+	_, err := m.record(ctx, policy.GetID(), PolicyUpdated, policy, 0)
+	return err
+}
+
+// Delete removes the policy and records its deletion. Deleting a policy which does not exist is not recorded.
+func (m *VersionedManager) Delete(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if exists, err := m.exists(ctx, id); err != nil {
+		return err
+	} else if !exists {
+		return m.Manager.Delete(ctx, id)
+	}
+
+	if err := m.Manager.Delete(ctx, id); err != nil {
+		return err
+	}
+	_, err := m.record(ctx, id, PolicyDeleted, nil, 0)
+	return err
+}
+
+// GetWithRevision retrieves a policy and its current revision. It returns ErrRevisionsNotSupported if the wrapped
+// Manager does not implement RevisionManager.
+func (m *VersionedManager) GetWithRevision(ctx context.Context, id string) (Policy, string, error) {
+	rm, err := m.revisions()
+	if err != nil {
+		return nil, "", err
+	}
+	return rm.GetWithRevision(ctx, id)
+}
+
+// UpdateIfRevision updates the policy if its current revision equals revision, records the new version and returns
+// the new revision. It returns ErrRevisionsNotSupported if the wrapped Manager does not implement RevisionManager.
+func (m *VersionedManager) UpdateIfRevision(ctx context.Context, policy Policy, revision string) (string, error) {
+	rm, err := m.revisions()
+	if err != nil {
+		return "", err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	next, err := rm.UpdateIfRevision(ctx, policy, revision)
+	if err != nil {
+		return "", err
+	}
+	if _, err := m.record(ctx, policy.GetID(), PolicyUpdated, policy, 0); err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// DeleteIfRevision removes the policy if its current revision equals revision and records its deletion. It returns
+// ErrRevisionsNotSupported if the wrapped Manager does not implement RevisionManager.
+func (m *VersionedManager) DeleteIfRevision(ctx context.Context, id string, revision string) error {
+	rm, err := m.revisions()
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if err := rm.DeleteIfRevision(ctx, id, revision); err != nil {
+		return err
+	}
+	_, err = m.record(ctx, id, PolicyDeleted, nil, 0)
+	return err
+}
+
+// revisions returns the wrapped Manager if it implements RevisionManager.
+func (m *VersionedManager) revisions() (RevisionManager, error) {
+	rm, ok := m.Manager.(RevisionManager)
+	if !ok {
+		return nil, errors.WithStack(ErrRevisionsNotSupported)
+	}
+	return rm, nil
+}
+
+// Watch streams the changes of policies, see Watcher. It returns ErrWatchNotSupported if the wrapped Manager does not
+// implement Watcher.
+func (m *VersionedManager) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	return watch(ctx, m.Manager, token)
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions. If the wrapped Manager does not implement MultiCandidateManager, the candidates are looked up
+// one combination at a time.
+func (m *VersionedManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	return findCandidates(ctx, m.Manager, &Request{}, subjects, resources, actions)
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources. If the wrapped Manager does not
+// implement HierarchicalResourceManager, the policies are looked up one resource at a time.
+func (m *VersionedManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	return findPoliciesForResources(ctx, m.Manager, resources)
+}
+
+// History returns copies of all recorded versions of the policy, oldest first. Modifying them does not change the
+// history.
+func (m *VersionedManager) History(ctx context.Context, id string) ([]*PolicyVersion, error) {
+	versions, err := m.store.GetVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return copyVersions(versions)
+}
+
+// GetAt returns the policy as it was at the given time. It returns ErrNotFound if the policy did not exist at that
+// time or no version was recorded before.
+func (m *VersionedManager) GetAt(ctx context.Context, id string, at time.Time) (Policy, error) {
+	versions, err := m.store.GetVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *PolicyVersion
+	for _, v := range versions {
+		if v.Time.After(at) {
+			break
+		}
+		current = v
+	}
+
+	if current == nil || current.Policy == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return copyPolicy(current.Policy)
+}
+
+// Rollback restores the given version of the policy and records the result as a new version. If the policy was
+// deleted in that version, it is deleted again.
+func (m *VersionedManager) Rollback(ctx context.Context, id string, version int) (*PolicyVersion, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	versions, err := m.store.GetVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var restore *PolicyVersion
+	for _, v := range versions {
+		if v.Version == version {
+			restore = v
+		}
+	}
+	if restore == nil {
+		return nil, errors.Wrapf(ErrNotFound, "Version %d of policy %s does not exist", version, id)
+	}
+
+	exists, err := m.exists(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if restore.Policy == nil {
+		if !exists {
+			return nil, errors.Errorf("Policy %s is deleted already", id)
+		}
+		if err := m.Manager.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+		return m.record(ctx, id, PolicyDeleted, nil, version)
+	}
+
+	policy, err := copyPolicy(restore.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if err := m.Manager.Create(ctx, policy); err != nil {
+			return nil, err
+		}
+		return m.record(ctx, id, PolicyCreated, policy, version)
+	}
+
+	if err := m.Manager.Update(ctx, policy); err != nil {
+		return nil, err
+	}
+	return m.record(ctx, id, PolicyUpdated, policy, version)
+}
+
+// exists returns true if the wrapped Manager has a policy with the given ID.
+func (m *VersionedManager) exists(ctx context.Context, id string) (bool, error) {
+	if _, err := m.Manager.Get(ctx, id); errors.Cause(err) == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *VersionedManager) record(ctx context.Context, id string, t ChangeType, policy Policy, restored int) (*PolicyVersion, error) {
+	versions, err := m.store.GetVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &PolicyVersion{
+		ID:              id,
+		Version:         len(versions) + 1,
+		Type:            t,
+		Actor:           ActorFromContext(ctx),
+		Time:            m.now(),
+		RestoredVersion: restored,
+	}
+
+	if policy != nil {
+		if v.Policy, err = copyPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.store.AddVersion(ctx, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// copyPolicy returns a deep copy of the policy, so that later modifications of the policy do not change the history.
+// Conditions, obligations and advice are copied through their JSON representation.
+func copyPolicy(p Policy) (*DefaultPolicy, error) {
+	c := ToDefaultPolicy(p)
+	if c.Conditions != nil {
+		conditions := Conditions{}
+		if err := copyJSON(c.Conditions, &conditions); err != nil {
+			return nil, err
+		}
+		c.Conditions = conditions
+	}
+
+	for _, obligations := range []*Obligations{&c.Obligations, &c.Advice} {
+		if *obligations == nil {
+			continue
+		}
+
+		var copied Obligations
+		if err := copyJSON(*obligations, &copied); err != nil {
+			return nil, err
+		}
+		*obligations = copied
+	}
+	return c, nil
+}
+
+// copyVersion returns a deep copy of the version, see copyPolicy.
+func copyVersion(v *PolicyVersion) (*PolicyVersion, error) {
+	c := *v
+	if v.Policy != nil {
+		p, err := copyPolicy(v.Policy)
+		if err != nil {
+			return nil, err
+		}
+		c.Policy = p
+	}
+	return &c, nil
+}
+
+func copyVersions(versions []*PolicyVersion) ([]*PolicyVersion, error) {
+	copies := make([]*PolicyVersion, len(versions))
+	for k, v := range versions {
+		c, err := copyVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		copies[k] = c
+	}
+	return copies, nil
+}
+
+// copyJSON copies src to dst through its JSON representation.
+func copyJSON(src, dst interface{}) error {
+	out, err := json.Marshal(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(out, dst))
+}
+
+// MemoryVersionStore is an in-memory VersionStore.
+type MemoryVersionStore struct {
+	versions map[string][]*PolicyVersion
+	sync.RWMutex
+}
+
+// NewMemoryVersionStore initializes a new MemoryVersionStore.
+func NewMemoryVersionStore() *MemoryVersionStore {
+	return &MemoryVersionStore{versions: map[string][]*PolicyVersion{}}
+}
+
+// AddVersion stores a copy of the version.
+func (s *MemoryVersionStore) AddVersion(ctx context.Context, v *PolicyVersion) error {
+	c, err := copyVersion(v)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.versions[v.ID] = append(s.versions[v.ID], c)
+	return nil
+}
+
+// GetVersions returns copies of all versions of a policy, oldest first.
+func (s *MemoryVersionStore) GetVersions(ctx context.Context, id string) ([]*PolicyVersion, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return copyVersions(s.versions[id])
+}
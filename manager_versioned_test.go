@@ -0,0 +1,247 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestVersionedManager(t *testing.T) {
+	for _, k := range []string{"memory", "sqlite", "bolt"} {
+		t.Run("manager="+k, func(t *testing.T) {
+			ctx := context.Background()
+			m := NewVersionedManager(managers[k](t), nil)
+
+			// Waits a little, so that every change has its own time.
+			tick := func() {
+				time.Sleep(time.Millisecond * 2)
+			}
+
+			start := time.Now()
+			tick()
+
+			p := &DefaultPolicy{ID: "articles", Description: "initial", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: AllowAccess, Conditions: Conditions{}}
+			require.NoError(t, m.Create(WithActor(ctx, "alice"), p))
+			tick()
+
+			// Modifying the policy after it was written must not change the history.
+			p.Description = "modified"
+			require.NoError(t, m.Update(WithActor(ctx, "bob"), &DefaultPolicy{ID: "articles", Description: "updated", Subjects: []string{"peter", "ken"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: DenyAccess, Conditions: Conditions{}}))
+			tick()
+
+			require.NoError(t, m.Delete(WithActor(ctx, "carol"), "articles"))
+			tick()
+
+			// Deleting a policy which does not exist is not recorded.
+			require.NoError(t, m.Delete(ctx, "articles"))
+
+			history, err := m.History(ctx, "articles")
+			require.NoError(t, err)
+			require.Len(t, history, 3)
+			for k, expected := range []struct {
+				t           ChangeType
+				actor       string
+				description string
+			}{
+				{t: PolicyCreated, actor: "alice", description: "initial"},
+				{t: PolicyUpdated, actor: "bob", description: "updated"},
+				{t: PolicyDeleted, actor: "carol"},
+			} {
+				assert.Equal(t, k+1, history[k].Version)
+				assert.Equal(t, "articles", history[k].ID)
+				assert.Equal(t, expected.t, history[k].Type)
+				assert.Equal(t, expected.actor, history[k].Actor)
+				assert.False(t, history[k].Time.Before(start))
+				if expected.description == "" {
+					assert.Nil(t, history[k].Policy)
+				} else {
+					assert.Equal(t, expected.description, history[k].Policy.Description)
+				}
+			}
+
+			_, err = m.GetAt(ctx, "articles", start)
+			assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+			got, err := m.GetAt(ctx, "articles", history[0].Time)
+			require.NoError(t, err)
+			assert.Equal(t, "initial", got.GetDescription())
+			assert.Equal(t, AllowAccess, got.GetEffect())
+
+			got, err = m.GetAt(ctx, "articles", history[2].Time.Add(-time.Nanosecond))
+			require.NoError(t, err)
+			assert.Equal(t, "updated", got.GetDescription())
+			assert.Equal(t, []string{"peter", "ken"}, got.GetSubjects())
+
+			_, err = m.GetAt(ctx, "articles", time.Now())
+			assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+			// Restoring a version of a deleted policy creates it again.
+			v, err := m.Rollback(WithActor(ctx, "dave"), "articles", 1)
+			require.NoError(t, err)
+			assert.Equal(t, 4, v.Version)
+			assert.Equal(t, PolicyCreated, v.Type)
+			assert.Equal(t, 1, v.RestoredVersion)
+			assert.Equal(t, "dave", v.Actor)
+
+			got, err = m.Get(ctx, "articles")
+			require.NoError(t, err)
+			assert.Equal(t, "initial", got.GetDescription())
+			assert.Equal(t, AllowAccess, got.GetEffect())
+
+			v, err = m.Rollback(ctx, "articles", 2)
+			require.NoError(t, err)
+			assert.Equal(t, PolicyUpdated, v.Type)
+			got, err = m.Get(ctx, "articles")
+			require.NoError(t, err)
+			assert.Equal(t, "updated", got.GetDescription())
+
+			v, err = m.Rollback(ctx, "articles", 3)
+			require.NoError(t, err)
+			assert.Equal(t, PolicyDeleted, v.Type)
+			_, err = m.Get(ctx, "articles")
+			assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+			_, err = m.Rollback(ctx, "articles", 3)
+			assert.Error(t, err)
+			_, err = m.Rollback(ctx, "articles", 10)
+			assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+			history, err = m.History(ctx, "articles")
+			require.NoError(t, err)
+			assert.Len(t, history, 6)
+		})
+	}
+}
+
+// opaquePolicy is a policy whose JSON representation differs from the one of DefaultPolicy.
+type opaquePolicy struct {
+	DefaultPolicy
+}
+
+func (p *opaquePolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"name": p.ID})
+}
+
+func TestVersionedManagerCustomPolicy(t *testing.T) {
+	ctx := context.Background()
+	m := NewVersionedManager(NewMemoryManager(), nil)
+
+	condition := &StringEqualCondition{Equals: "acme"}
+	expected := DefaultPolicy{
+		ID:          "1",
+		Subjects:    []string{"peter"},
+		Actions:     []string{"view"},
+		Resources:   []string{"articles"},
+		Effect:      DenyAccess,
+		Priority:    3,
+		Conditions:  Conditions{"tenant": condition},
+		NotSubjects: []string{"ken"},
+		Obligations: Obligations{"log": &LogObligation{Stream: "audit"}},
+	}
+	p := &opaquePolicy{DefaultPolicy: expected}
+	p.Conditions = Conditions{"tenant": condition}
+	require.NoError(t, m.Create(ctx, p))
+
+	// Modifying a condition after the policy was written must not change the history.
+	condition.Equals = "other"
+	expected.Conditions = Conditions{"tenant": &StringEqualCondition{Equals: "acme"}}
+
+	versions, err := m.History(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, &expected, versions[0].Policy)
+}
+
+func TestVersionedManagerHistoryCopies(t *testing.T) {
+	ctx := context.Background()
+	m := NewVersionedManager(NewMemoryManager(), nil)
+
+	condition := &StringEqualCondition{Equals: "acme"}
+	require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: AllowAccess, Conditions: Conditions{"tenant": condition}}))
+	versions, err := m.History(ctx, "1")
+	require.NoError(t, err)
+	expected := versions[0].Policy
+
+	// Modifying the returned versions, including the one returned by Rollback, must not change the history.
+	versions, err = m.History(ctx, "1")
+	require.NoError(t, err)
+	versions[0].Version = 7
+	versions[0].Policy.Subjects[0] = "ken"
+	versions[0].Policy.Conditions["tenant"].(*StringEqualCondition).Equals = "other"
+
+	restored, err := m.Rollback(ctx, "1", 1)
+	require.NoError(t, err)
+	restored.Policy.Description = "modified"
+
+	versions, err = m.History(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, expected, versions[0].Policy)
+	assert.Equal(t, expected, versions[1].Policy)
+}
+
+func TestVersionedManagerRevisions(t *testing.T) {
+	ctx := context.Background()
+	m := NewVersionedManager(NewMemoryManager(), nil)
+
+	p := &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: AllowAccess}
+	require.NoError(t, m.Create(ctx, p))
+	_, revision, err := m.GetWithRevision(ctx, "1")
+	require.NoError(t, err)
+
+	updated := &DefaultPolicy{ID: "1", Subjects: []string{"ken"}, Actions: []string{"view"}, Resources: []string{"articles"}, Effect: AllowAccess}
+	next, err := m.UpdateIfRevision(WithActor(ctx, "alice"), updated, revision)
+	require.NoError(t, err)
+
+	// Conflicting changes are not recorded.
+	_, err = m.UpdateIfRevision(ctx, p, revision)
+	assert.True(t, IsConflict(err))
+	assert.True(t, IsConflict(m.DeleteIfRevision(ctx, "1", revision)))
+
+	require.NoError(t, m.DeleteIfRevision(WithActor(ctx, "bob"), "1", next))
+
+	versions, err := m.History(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, PolicyUpdated, versions[1].Type)
+	assert.Equal(t, "alice", versions[1].Actor)
+	assert.Equal(t, []string{"ken"}, versions[1].Policy.Subjects)
+	assert.Equal(t, PolicyDeleted, versions[2].Type)
+	assert.Equal(t, "bob", versions[2].Actor)
+
+	unsupported := NewVersionedManager(struct{ Manager }{NewMemoryManager()}, nil)
+	_, _, err = unsupported.GetWithRevision(ctx, "1")
+	assert.Equal(t, ErrRevisionsNotSupported, errors.Cause(err))
+	_, err = unsupported.UpdateIfRevision(ctx, p, "1")
+	assert.Equal(t, ErrRevisionsNotSupported, errors.Cause(err))
+	assert.Equal(t, ErrRevisionsNotSupported, errors.Cause(unsupported.DeleteIfRevision(ctx, "1", "1")))
+}
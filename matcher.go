@@ -20,8 +20,22 @@
 
 package ladon
 
+import "context"
+
 type matcher interface {
 	Matches(p Policy, haystack []string, needle string) (matches bool, error error)
 }
 
+// exclusionMatcher is implemented by matchers which are able to match a needle with a haystack while excluding
+// the needles which match one of the exclusions.
+type exclusionMatcher interface {
+	MatchesExcluding(p Policy, haystack []string, exclusions []string, needle string) (matches bool, error error)
+}
+
+// contextMatcher is implemented by matchers which stop matching once the context of the access request is canceled
+// and which bound the duration of a match by the context's deadline.
+type contextMatcher interface {
+	MatchesContext(ctx context.Context, p Policy, haystack []string, needle string) (matches bool, error error)
+}
+
 var DefaultMatcher = NewRegexpMatcher(512)
@@ -21,7 +21,10 @@
 package ladon
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dlclark/regexp2"
 	"github.com/hashicorp/golang-lru"
@@ -62,6 +65,62 @@ func (m *RegexpMatcher) set(pattern string, reg *regexp2.Regexp) {
 
 // Matches a needle with an array of regular expressions and returns true if a match was found.
 func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (bool, error) {
+	return m.matches(p, haystack, needle, compiler.DefaultMatchTimeout)
+}
+
+// MatchesContext works like Matches but returns ErrRequestCanceled if ctx is canceled. If ctx has a deadline which
+// is earlier than compiler.DefaultMatchTimeout, a single match may take at most until the deadline.
+func (m *RegexpMatcher) MatchesContext(ctx context.Context, p Policy, haystack []string, needle string) (bool, error) {
+	for {
+		if ctx.Err() != nil {
+			return false, errors.WithStack(ErrRequestCanceled)
+		}
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return m.matches(p, haystack, needle, compiler.DefaultMatchTimeout)
+		}
+
+		timeout := matchTimeout(time.Until(deadline))
+		matched, err := m.matches(p, haystack, needle, timeout)
+		if err == nil || !isMatchTimeout(err) || timeout == compiler.DefaultMatchTimeout {
+			return matched, err
+		} else if time.Until(deadline) <= 0 {
+			// The match timed out because the deadline is exceeded.
+			return false, errors.WithStack(ErrRequestCanceled)
+		}
+
+		// The match was cut short although time is left, so it is retried with the time that is left.
+	}
+}
+
+// matchTimeouts are the match timeouts used for requests with a deadline, from the longest to the shortest. Only
+// these variants of each regular expression are compiled and cached.
+var matchTimeouts = []time.Duration{
+	compiler.DefaultMatchTimeout,
+	100 * time.Millisecond,
+	25 * time.Millisecond,
+	5 * time.Millisecond,
+	time.Millisecond,
+}
+
+// matchTimeout returns the longest of matchTimeouts which does not exceed remaining, or the shortest one.
+func matchTimeout(remaining time.Duration) time.Duration {
+	for _, timeout := range matchTimeouts {
+		if timeout <= remaining {
+			return timeout
+		}
+	}
+	return matchTimeouts[len(matchTimeouts)-1]
+}
+
+// isMatchTimeout returns true if err was returned because a match took longer than the regular expression's
+// timeout. regexp2 does not export a type for this error, so it is recognized by its message.
+func isMatchTimeout(err error) bool {
+	return strings.HasPrefix(errors.Cause(err).Error(), "match timeout")
+}
+
+func (m *RegexpMatcher) matches(p Policy, haystack []string, needle string, timeout time.Duration) (bool, error) {
 	var reg *regexp2.Regexp
 	var err error
 	for _, h := range haystack {
@@ -77,7 +136,12 @@ func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (boo
 			continue
 		}
 
-		if reg = m.get(h); reg != nil {
+		key := h
+		if timeout != compiler.DefaultMatchTimeout {
+			key = fmt.Sprintf("%s\x00%s", h, timeout)
+		}
+
+		if reg = m.get(key); reg != nil {
 			if matched, err := reg.MatchString(needle); err != nil {
 				// according to regexp2 documentation: https://github.com/dlclark/regexp2#usage
 				// The only error that the *Match* methods should return is a Timeout if you set the
@@ -89,12 +153,12 @@ func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (boo
 			continue
 		}
 
-		reg, err = compiler.CompileRegex(h, p.GetStartDelimiter(), p.GetEndDelimiter())
+		reg, err = compiler.CompileRegexWithTimeout(h, p.GetStartDelimiter(), p.GetEndDelimiter(), timeout)
 		if err != nil {
 			return false, errors.WithStack(err)
 		}
 
-		m.set(h, reg)
+		m.set(key, reg)
 		if matched, err := reg.MatchString(needle); err != nil {
 			// according to regexp2 documentation: https://github.com/dlclark/regexp2#usage
 			// The only error that the *Match* methods should return is a Timeout if you set the
@@ -106,3 +170,19 @@ func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (boo
 	}
 	return false, nil
 }
+
+// MatchesExcluding matches a needle with an array of regular expressions and returns true if a match was found and
+// the needle does not match any of the exclusions.
+func (m *RegexpMatcher) MatchesExcluding(p Policy, haystack []string, exclusions []string, needle string) (bool, error) {
+	if matched, err := m.Matches(p, haystack, needle); err != nil || !matched {
+		return false, err
+	} else if len(exclusions) == 0 {
+		return true, nil
+	}
+
+	excluded, err := m.Matches(p, exclusions, needle)
+	if err != nil {
+		return false, err
+	}
+	return !excluded, nil
+}
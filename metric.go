@@ -22,7 +22,8 @@ package ladon
 
 // Metric is used to expose metrics about authz
 type Metric interface {
-	// RequestDeniedBy is called when we get explicit deny by policy
+	// RequestDeniedBy is called when we get explicit deny by policy. The policy is nil if the combining algorithm
+	// did not name the denying policy.
 	RequestDeniedBy(Request, Policy)
 	// RequestAllowedBy is called when a matching policy has been found.
 	RequestAllowedBy(Request, Policies)
@@ -0,0 +1,176 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Obligation is an instruction a policy attaches to its effect, for example "redact personal data" or "log to the
+// compliance stream". Ladon does not act on obligations itself but returns them with the decision so that the
+// enforcement point can. Obligations must be fulfilled by the enforcement point, advice may be ignored.
+type Obligation interface {
+	// GetName returns the obligation's name.
+	GetName() string
+}
+
+// Obligations is a collection of obligations or advice.
+type Obligations map[string]Obligation
+
+// AddObligation adds an obligation to the collection.
+func (obs Obligations) AddObligation(key string, o Obligation) {
+	obs[key] = o
+}
+
+// MarshalJSON marshals a list of obligations to json.
+func (obs Obligations) MarshalJSON() ([]byte, error) {
+	out := make(map[string]*jsonObligation, len(obs))
+	for k, o := range obs {
+		raw, err := json.Marshal(o)
+		if err != nil {
+			return []byte{}, errors.WithStack(err)
+		}
+
+		out[k] = &jsonObligation{
+			Type:    o.GetName(),
+			Options: json.RawMessage(raw),
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals a list of obligations from json.
+func (obs *Obligations) UnmarshalJSON(data []byte) error {
+	var jos map[string]jsonObligation
+	if err := json.Unmarshal(data, &jos); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if jos == nil {
+		*obs = nil
+		return nil
+	}
+
+	out := make(Obligations, len(jos))
+	for k, jo := range jos {
+		factory, ok := ObligationFactories[jo.Type]
+		if !ok {
+			return errors.Errorf("Could not find obligation type %s", jo.Type)
+		}
+
+		o := factory()
+		if len(jo.Options) > 0 {
+			if err := json.Unmarshal(jo.Options, o); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		out[k] = o
+	}
+
+	*obs = out
+	return nil
+}
+
+// merge adds all obligations of o which are not part of the collection yet. It returns the resulting collection which
+// is nil if neither contains any obligation.
+func (obs Obligations) merge(o Obligations) Obligations {
+	for k, v := range o {
+		if _, ok := obs[k]; ok {
+			continue
+		}
+
+		if obs == nil {
+			obs = Obligations{}
+		}
+		obs[k] = v
+	}
+	return obs
+}
+
+type jsonObligation struct {
+	Type    string          `json:"type"`
+	Options json.RawMessage `json:"options"`
+}
+
+// ObligationFactories is where you can add custom obligations
+var ObligationFactories = map[string]func() Obligation{
+	new(RedactObligation).GetName(): func() Obligation {
+		return new(RedactObligation)
+	},
+	new(LogObligation).GetName(): func() Obligation {
+		return new(LogObligation)
+	},
+}
+
+// ObligationPolicy is implemented by policies which attach obligations and advice to their effect. When a request is
+// decided, the obligations and advice of the policies which decided it and whose effect equals the decision are
+// merged and returned with the Decision.
+type ObligationPolicy interface {
+	Policy
+
+	// GetObligations returns the obligations the enforcement point must fulfill if the policy decides a request.
+	GetObligations() Obligations
+
+	// GetAdvice returns the advice the enforcement point may follow if the policy decides a request.
+	GetAdvice() Obligations
+}
+
+// RedactObligation instructs the enforcement point to redact the given fields from the response.
+type RedactObligation struct {
+	Fields []string `json:"fields"`
+}
+
+// GetName returns the obligation's name.
+func (o *RedactObligation) GetName() string {
+	return "RedactObligation"
+}
+
+// LogObligation instructs the enforcement point to log the access request to the given stream.
+type LogObligation struct {
+	Stream string `json:"stream"`
+}
+
+// GetName returns the obligation's name.
+func (o *LogObligation) GetName() string {
+	return "LogObligation"
+}
+
+// obligationsOf merges the obligations and advice of the deciders whose effect equals effect. Only Permit and Deny
+// decisions carry obligations.
+func obligationsOf(effect Effect, deciders Policies) (obligations Obligations, advice Obligations) {
+	if effect != Permit && effect != Deny {
+		return nil, nil
+	}
+
+	for _, p := range deciders {
+		op, ok := p.(ObligationPolicy)
+		if !ok || op.AllowAccess() != (effect == Permit) {
+			continue
+		}
+
+		obligations = obligations.merge(op.GetObligations())
+		advice = advice.merge(op.GetAdvice())
+	}
+	return obligations, advice
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestObligationsJSON(t *testing.T) {
+	obligations := Obligations{
+		"redact": &RedactObligation{Fields: []string{"email", "phone"}},
+		"audit":  &LogObligation{Stream: "compliance"},
+	}
+
+	out, err := json.Marshal(obligations)
+	require.NoError(t, err)
+
+	var in Obligations
+	require.NoError(t, json.Unmarshal(out, &in))
+	assert.Equal(t, obligations, in)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"foo":{"type":"UnknownObligation"}}`), &in))
+}
+
+func TestPolicyObligationsJSON(t *testing.T) {
+	p := &DefaultPolicy{
+		ID:          "1",
+		Subjects:    []string{"peter"},
+		Effect:      AllowAccess,
+		Conditions:  Conditions{},
+		Obligations: Obligations{"redact": &RedactObligation{Fields: []string{"email"}}},
+		Advice:      Obligations{"audit": &LogObligation{Stream: "compliance"}},
+	}
+
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var in DefaultPolicy
+	require.NoError(t, json.Unmarshal(out, &in))
+	assert.Equal(t, p, &in)
+
+	// Policies without obligations are serialized exactly as before.
+	out, err = json.Marshal(&DefaultPolicy{ID: "2"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "obligations")
+	assert.NotContains(t, string(out), "advice")
+}
+
+func TestDecisionObligations(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{}
+
+	redactEmail := &RedactObligation{Fields: []string{"email"}}
+	redactAll := &RedactObligation{Fields: []string{"email", "phone"}}
+	audit := &LogObligation{Stream: "compliance"}
+	alert := &LogObligation{Stream: "alerts"}
+
+	policies := Policies{
+		&DefaultPolicy{
+			ID:          "1",
+			Subjects:    []string{"<.*>"},
+			Actions:     []string{"<view|delete>"},
+			Resources:   []string{"users:<.*>"},
+			Effect:      AllowAccess,
+			Obligations: Obligations{"redact": redactEmail},
+			Advice:      Obligations{"audit": audit},
+		},
+		&DefaultPolicy{
+			ID:          "2",
+			Subjects:    []string{"<.*>"},
+			Actions:     []string{"view"},
+			Resources:   []string{"users:<.*>"},
+			Effect:      AllowAccess,
+			Obligations: Obligations{"redact": redactAll, "audit": audit},
+		},
+		&DefaultPolicy{
+			ID:          "3",
+			Subjects:    []string{"guest"},
+			Actions:     []string{"delete"},
+			Resources:   []string{"users:<.*>"},
+			Effect:      DenyAccess,
+			Obligations: Obligations{"alert": alert},
+		},
+		&DefaultPolicy{
+			ID:        "4",
+			Subjects:  []string{"peter"},
+			Actions:   []string{"update"},
+			Resources: []string{"users:<.*>"},
+			Effect:    AllowAccess,
+		},
+	}
+
+	t.Run("case=permit merges obligations of all deciders", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{Subject: "peter", Action: "view", Resource: "users:1"}, policies)
+		require.NoError(t, err)
+		assert.Equal(t, Obligations{"redact": redactEmail, "audit": audit}, d.Obligations)
+		assert.Equal(t, Obligations{"audit": audit}, d.Advice)
+	})
+
+	t.Run("case=deny only carries obligations of denying policies", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{Subject: "guest", Action: "delete", Resource: "users:1"}, policies)
+		require.Error(t, err)
+		assert.Equal(t, []string{"1", "3"}, d.Deciders)
+		assert.Equal(t, Obligations{"alert": alert}, d.Obligations)
+		assert.Nil(t, d.Advice)
+	})
+
+	t.Run("case=not applicable carries no obligations", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{Subject: "peter", Action: "create", Resource: "users:1"}, policies)
+		require.Error(t, err)
+		assert.Nil(t, d.Obligations)
+		assert.Nil(t, d.Advice)
+	})
+
+	t.Run("case=policies without obligations", func(t *testing.T) {
+		d, err := warden.ExplainPolicies(ctx, &Request{Subject: "peter", Action: "update", Resource: "users:1"}, policies)
+		require.NoError(t, err)
+		assert.Nil(t, d.Obligations)
+		assert.Nil(t, d.Advice)
+	})
+}
@@ -65,6 +65,22 @@ type Policy interface {
 	GetEndDelimiter() byte
 }
 
+// ExclusionPolicy is implemented by policies which exclude subjects, resources or actions. A request only matches
+// such a policy if its subject, resource and action match the policy and are not excluded by it. Exclusions support
+// regular expressions just like subjects, resources and actions do.
+type ExclusionPolicy interface {
+	Policy
+
+	// GetNotSubjects returns the subjects the policy does not apply to.
+	GetNotSubjects() []string
+
+	// GetNotResources returns the resources the policy does not apply to.
+	GetNotResources() []string
+
+	// GetNotActions returns the actions the policy does not apply to.
+	GetNotActions() []string
+}
+
 // DefaultPolicy is the default implementation of the policy interface.
 type DefaultPolicy struct {
 	ID          string     `json:"id" gorethink:"id"`
@@ -75,6 +91,14 @@ type DefaultPolicy struct {
 	Actions     []string   `json:"actions" gorethink:"actions"`
 	Conditions  Conditions `json:"conditions" gorethink:"conditions"`
 	Meta        []byte     `json:"meta" gorethink:"meta"`
+	Priority    int        `json:"priority,omitempty" gorethink:"priority,omitempty"`
+
+	NotSubjects  []string `json:"not_subjects,omitempty" gorethink:"not_subjects,omitempty"`
+	NotResources []string `json:"not_resources,omitempty" gorethink:"not_resources,omitempty"`
+	NotActions   []string `json:"not_actions,omitempty" gorethink:"not_actions,omitempty"`
+
+	Obligations Obligations `json:"obligations,omitempty" gorethink:"obligations,omitempty"`
+	Advice      Obligations `json:"advice,omitempty" gorethink:"advice,omitempty"`
 }
 
 // UnmarshalJSON overwrite own policy with values of the given in policy in JSON format
@@ -88,6 +112,14 @@ func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 		Actions     []string   `json:"actions" gorethink:"actions"`
 		Conditions  Conditions `json:"conditions" gorethink:"conditions"`
 		Meta        []byte     `json:"meta" gorethink:"meta"`
+		Priority    int        `json:"priority,omitempty" gorethink:"priority,omitempty"`
+
+		NotSubjects  []string `json:"not_subjects,omitempty" gorethink:"not_subjects,omitempty"`
+		NotResources []string `json:"not_resources,omitempty" gorethink:"not_resources,omitempty"`
+		NotActions   []string `json:"not_actions,omitempty" gorethink:"not_actions,omitempty"`
+
+		Obligations Obligations `json:"obligations,omitempty" gorethink:"obligations,omitempty"`
+		Advice      Obligations `json:"advice,omitempty" gorethink:"advice,omitempty"`
 	}{
 		Conditions: Conditions{},
 	}
@@ -105,6 +137,14 @@ func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 		Actions:     pol.Actions,
 		Conditions:  pol.Conditions,
 		Meta:        pol.Meta,
+		Priority:    pol.Priority,
+
+		NotSubjects:  pol.NotSubjects,
+		NotResources: pol.NotResources,
+		NotActions:   pol.NotActions,
+
+		Obligations: pol.Obligations,
+		Advice:      pol.Advice,
 	}
 	return nil
 }
@@ -163,6 +203,36 @@ func (p *DefaultPolicy) GetMeta() []byte {
 	return p.Meta
 }
 
+// GetPriority returns the policies priority.
+func (p *DefaultPolicy) GetPriority() int {
+	return p.Priority
+}
+
+// GetNotSubjects returns the subjects the policy does not apply to.
+func (p *DefaultPolicy) GetNotSubjects() []string {
+	return p.NotSubjects
+}
+
+// GetNotResources returns the resources the policy does not apply to.
+func (p *DefaultPolicy) GetNotResources() []string {
+	return p.NotResources
+}
+
+// GetNotActions returns the actions the policy does not apply to.
+func (p *DefaultPolicy) GetNotActions() []string {
+	return p.NotActions
+}
+
+// GetObligations returns the obligations the enforcement point must fulfill if the policy decides a request.
+func (p *DefaultPolicy) GetObligations() Obligations {
+	return p.Obligations
+}
+
+// GetAdvice returns the advice the enforcement point may follow if the policy decides a request.
+func (p *DefaultPolicy) GetAdvice() Obligations {
+	return p.Advice
+}
+
 // GetEndDelimiter returns the delimiter which identifies the end of a regular expression.
 func (p *DefaultPolicy) GetEndDelimiter() byte {
 	return '>'
@@ -172,3 +242,62 @@ func (p *DefaultPolicy) GetEndDelimiter() byte {
 func (p *DefaultPolicy) GetStartDelimiter() byte {
 	return '<'
 }
+
+// ToDefaultPolicy returns a DefaultPolicy with the values of p, including its priority, exclusions, obligations and
+// advice. Slices and maps are copied, the conditions and obligations in them are not.
+func ToDefaultPolicy(p Policy) *DefaultPolicy {
+	dp := &DefaultPolicy{
+		ID:          p.GetID(),
+		Description: p.GetDescription(),
+		Subjects:    copyStrings(p.GetSubjects()),
+		Effect:      p.GetEffect(),
+		Resources:   copyStrings(p.GetResources()),
+		Actions:     copyStrings(p.GetActions()),
+		Conditions:  copyConditions(p.GetConditions()),
+		Priority:    GetPolicyPriority(p),
+	}
+
+	if meta := p.GetMeta(); meta != nil {
+		dp.Meta = append([]byte{}, meta...)
+	}
+	if ep, ok := p.(ExclusionPolicy); ok {
+		dp.NotSubjects = copyStrings(ep.GetNotSubjects())
+		dp.NotResources = copyStrings(ep.GetNotResources())
+		dp.NotActions = copyStrings(ep.GetNotActions())
+	}
+	if op, ok := p.(ObligationPolicy); ok {
+		dp.Obligations, dp.Advice = copyObligations(op.GetObligations()), copyObligations(op.GetAdvice())
+	}
+	return dp
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyConditions(cs Conditions) Conditions {
+	if cs == nil {
+		return nil
+	}
+
+	c := make(Conditions, len(cs))
+	for k, v := range cs {
+		c[k] = v
+	}
+	return c
+}
+
+func copyObligations(os Obligations) Obligations {
+	if os == nil {
+		return nil
+	}
+
+	c := make(Obligations, len(os))
+	for k, v := range os {
+		c[k] = v
+	}
+	return c
+}
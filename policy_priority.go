@@ -0,0 +1,51 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "sort"
+
+// PrioritizedPolicy is implemented by policies which have a priority. Policies with a higher priority are evaluated
+// before policies with a lower priority. Policies which do not implement this interface have priority 0.
+type PrioritizedPolicy interface {
+	Policy
+
+	// GetPriority returns the policies priority.
+	GetPriority() int
+}
+
+// GetPolicyPriority returns the priority of p if it implements PrioritizedPolicy and 0 otherwise.
+func GetPolicyPriority(p Policy) int {
+	if pp, ok := p.(PrioritizedPolicy); ok {
+		return pp.GetPriority()
+	}
+	return 0
+}
+
+// sortByPriority returns the policies sorted by descending priority. Policies with the same priority keep their
+// order. The given slice is not modified.
+func sortByPriority(policies Policies) Policies {
+	sorted := make(Policies, len(policies))
+	copy(sorted, policies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return GetPolicyPriority(sorted[i]) > GetPolicyPriority(sorted[j])
+	})
+	return sorted
+}
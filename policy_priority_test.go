@@ -0,0 +1,129 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type unprioritizedPolicy struct {
+	DefaultPolicy
+}
+
+func (p *unprioritizedPolicy) GetPriority() string {
+	return "not a PrioritizedPolicy"
+}
+
+func TestGetPolicyPriority(t *testing.T) {
+	assert.Equal(t, 5, GetPolicyPriority(&DefaultPolicy{Priority: 5}))
+	assert.Equal(t, 0, GetPolicyPriority(&unprioritizedPolicy{DefaultPolicy{Priority: 5}}))
+}
+
+func TestPolicyPriorityOrder(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager(), CombiningAlgorithm: &FirstApplicableAlgorithm{}}
+	for _, p := range []Policy{
+		&DefaultPolicy{ID: "c", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: AllowAccess},
+		&DefaultPolicy{ID: "a", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: DenyAccess},
+		&DefaultPolicy{ID: "b", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: AllowAccess, Priority: 1},
+		&DefaultPolicy{ID: "d", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: DenyAccess, Priority: -1},
+	} {
+		require.NoError(t, warden.Manager.Create(ctx, p))
+	}
+
+	for i := 0; i < 10; i++ {
+		d, err := warden.Explain(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, d.Deciders)
+
+		var order []string
+		for _, e := range d.Evaluations {
+			order = append(order, e.PolicyID)
+		}
+		assert.Equal(t, []string{"b", "c", "a", "d"}, order)
+	}
+}
+
+func TestHighestPriorityAlgorithm(t *testing.T) {
+	broadDeny := &DefaultPolicy{
+		ID:        "broad-deny",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"<.*>"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    DenyAccess,
+	}
+	specificAllow := &DefaultPolicy{
+		ID:        "specific-allow",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    AllowAccess,
+		Priority:  10,
+	}
+	specificDeny := &DefaultPolicy{
+		ID:        "specific-deny",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:1234"},
+		Effect:    DenyAccess,
+		Priority:  10,
+	}
+	lowAllow := &DefaultPolicy{
+		ID:        "low-allow",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"<.*>"},
+		Resources: []string{"printers:<.*>"},
+		Effect:    AllowAccess,
+		Priority:  -10,
+	}
+	policies := Policies{broadDeny, lowAllow, specificAllow, specificDeny}
+	warden := &Ladon{CombiningAlgorithm: &HighestPriorityAlgorithm{}}
+	ctx := context.Background()
+
+	d, err := warden.ExplainPolicies(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"}, policies)
+	require.NoError(t, err)
+	assert.Equal(t, "highest-priority", d.Algorithm)
+	assert.Equal(t, []string{"specific-allow"}, d.Deciders)
+
+	d, err = warden.ExplainPolicies(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1234"}, policies)
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+	assert.Equal(t, []string{"specific-allow", "specific-deny"}, d.Deciders)
+
+	d, err = warden.ExplainPolicies(ctx, &Request{Subject: "ken", Action: "view", Resource: "articles:1"}, policies)
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+	assert.Equal(t, []string{"broad-deny"}, d.Deciders)
+	assert.False(t, d.Evaluations[len(d.Evaluations)-1].Evaluated, "policies with a lower priority must not be evaluated")
+
+	d, err = warden.ExplainPolicies(ctx, &Request{Subject: "ken", Action: "view", Resource: "printers:1"}, policies)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"low-allow"}, d.Deciders)
+
+	_, err = warden.ExplainPolicies(ctx, &Request{Subject: "ken", Action: "view", Resource: "users:1"}, policies)
+	assert.Equal(t, ErrRequestDenied, errors.Cause(err))
+}
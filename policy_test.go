@@ -44,11 +44,23 @@ var policyCases = []*DefaultPolicy{
 		Resources:   []string{"articles:<[0-9]+>"},
 		Actions:     []string{"create", "update"},
 		Conditions:  policyConditions,
+		Priority:    10,
 	},
 	{
 		Effect:     DenyAccess,
 		Conditions: make(Conditions),
 	},
+	{
+		ID:           "2",
+		Subjects:     []string{"<.*>"},
+		NotSubjects:  []string{"admin"},
+		Effect:       AllowAccess,
+		Resources:    []string{"articles:<.*>"},
+		NotResources: []string{"articles:<[0-9]+>"},
+		Actions:      []string{"<.*>"},
+		NotActions:   []string{"delete"},
+		Conditions:   make(Conditions),
+	},
 }
 
 type TestMeta struct {
@@ -60,6 +72,22 @@ func TestHasAccess(t *testing.T) {
 	assert.False(t, policyCases[1].AllowAccess())
 }
 
+func TestUnmarshalExclusions(t *testing.T) {
+	var p DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"subjects":["<.*>"],"not_subjects":["peter"],"not_resources":["a"],"not_actions":["b"]}`), &p))
+	assert.Equal(t, []string{"peter"}, p.NotSubjects)
+	assert.Equal(t, []string{"a"}, p.NotResources)
+	assert.Equal(t, []string{"b"}, p.NotActions)
+}
+
+func TestMarshalOmitsEmptyFields(t *testing.T) {
+	data, err := json.Marshal(policyCases[1])
+	require.NoError(t, err)
+	for _, field := range []string{"priority", "not_subjects", "not_resources", "not_actions", "obligations", "advice"} {
+		assert.NotContains(t, string(data), `"`+field+`"`)
+	}
+}
+
 func TestMarshalling(t *testing.T) {
 	for k, c := range policyCases {
 		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
@@ -103,6 +131,10 @@ func TestGetters(t *testing.T) {
 		assert.Equal(t, len(c.Conditions), len(c.GetConditions()))
 		assert.Equal(t, c.Effect, c.GetEffect())
 		assert.Equal(t, c.Actions, c.GetActions())
+		assert.Equal(t, c.Priority, c.GetPriority())
+		assert.Equal(t, c.NotSubjects, c.GetNotSubjects())
+		assert.Equal(t, c.NotResources, c.GetNotResources())
+		assert.Equal(t, c.NotActions, c.GetNotActions())
 		assert.Equal(t, byte('<'), c.GetStartDelimiter())
 		assert.Equal(t, byte('>'), c.GetEndDelimiter())
 	}
@@ -116,3 +148,54 @@ func RequireError(t *testing.T, expectError bool, err error, args ...interface{}
 	}
 	require.Equal(t, expectError, err != nil)
 }
+
+func TestToDefaultPolicy(t *testing.T) {
+	p := &DefaultPolicy{
+		ID:           "1",
+		Subjects:     []string{"peter"},
+		Resources:    []string{"articles"},
+		Actions:      []string{"view"},
+		Effect:       DenyAccess,
+		Conditions:   Conditions{"owner": &EqualsSubjectCondition{}},
+		Meta:         []byte("meta"),
+		Priority:     5,
+		NotSubjects:  []string{"ken"},
+		Obligations:  Obligations{"log": &LogObligation{Stream: "audit"}},
+		NotResources: []string{},
+	}
+
+	c := ToDefaultPolicy(p)
+	assert.Equal(t, p, c)
+
+	// Changing the copy does not change the policy.
+	c.Subjects[0] = "max"
+	c.NotSubjects[0] = "max"
+	c.Meta[0] = 'M'
+	delete(c.Conditions, "owner")
+	delete(c.Obligations, "log")
+	assert.Equal(t, []string{"peter"}, p.Subjects)
+	assert.Equal(t, []string{"ken"}, p.NotSubjects)
+	assert.Equal(t, []byte("meta"), p.Meta)
+	assert.Len(t, p.Conditions, 1)
+	assert.Len(t, p.Obligations, 1)
+}
+
+func TestIndexPrefix(t *testing.T) {
+	p := &DefaultPolicy{}
+	for item, expected := range map[string]struct {
+		prefix string
+		exact  bool
+	}{
+		"articles:1":            {prefix: "articles:1", exact: true},
+		"articles:<[0-9]+>":     {prefix: "articles:"},
+		"users:${subject}":      {prefix: "users:"},
+		"users:${subject}:<.*>": {prefix: "users:"},
+		"users:<.*>:${subject}": {prefix: "users:"},
+		"<.*>":                  {prefix: ""},
+		"":                      {prefix: "", exact: true},
+	} {
+		prefix, exact := IndexPrefix(p, item)
+		assert.Equal(t, expected.prefix, prefix, item)
+		assert.Equal(t, expected.exact, exact, item)
+	}
+}
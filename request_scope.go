@@ -0,0 +1,137 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "context"
+
+// requestScope contains what a request is matched with in addition to the request itself.
+type requestScope struct {
+	// subjects contains the request's subject followed by all roles and groups it transitively belongs to.
+	subjects []string
+
+	// resources contains the request's resource followed by its ancestors if resource hierarchies are enabled.
+	resources []string
+
+	// actions contains the request's action followed by all action groups which contain it.
+	actions []string
+}
+
+// scope computes the requestScope of r.
+func (l *Ladon) scope(ctx context.Context, r *Request) (*requestScope, error) {
+	subjects, err := l.resolveSubject(ctx, r.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return l.newScope(r, subjects), nil
+}
+
+// newScope returns the requestScope of r given the already resolved subjects of r.
+func (l *Ladon) newScope(r *Request, subjects []string) *requestScope {
+	return &requestScope{
+		subjects:  subjects,
+		resources: l.resolveResource(r.Resource),
+		actions:   l.resolveAction(r.Action),
+	}
+}
+
+// MultiCandidateManager may optionally be implemented by a Manager. If a request is matched with the roles of its
+// subject, the ancestors of its resource or the groups of its action, Ladon uses it to find the candidates with a
+// single call instead of one FindRequestCandidates call per combination of subject, resource and action.
+type MultiCandidateManager interface {
+	Manager
+
+	// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+	// any of the actions. It either returns a set of policies that apply to such requests, or a superset of it.
+	// If an error occurs, it returns nil and the error.
+	FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error)
+}
+
+// findRequestCandidates returns the candidates for the request and all subjects, resources and actions of its scope.
+func (l *Ladon) findRequestCandidates(ctx context.Context, r *Request, scope *requestScope) (Policies, error) {
+	if len(scope.subjects) == 1 && len(scope.resources) == 1 && len(scope.actions) == 1 {
+		return l.Manager.FindRequestCandidates(ctx, r)
+	}
+	return findCandidates(ctx, l.Manager, r, scope.subjects, scope.resources, scope.actions)
+}
+
+// findCandidates returns the candidates for r with any of the subjects, any of the resources and any of the actions.
+// It uses the most efficient lookup m implements and falls back to one FindRequestCandidates call per combination.
+func findCandidates(ctx context.Context, m Manager, r *Request, subjects, resources, actions []string) (Policies, error) {
+	if mm, ok := m.(MultiCandidateManager); ok {
+		return mm.FindCandidates(ctx, subjects, resources, actions)
+	} else if hm, ok := m.(HierarchicalResourceManager); ok && len(resources) > 1 {
+		return hm.FindPoliciesForResources(ctx, resources)
+	}
+
+	var sets []Policies
+	for _, subject := range subjects {
+		for _, resource := range resources {
+			for _, action := range actions {
+				rr := *r
+				rr.Subject = subject
+				rr.Resource = resource
+				rr.Action = action
+				policies, err := m.FindRequestCandidates(ctx, &rr)
+				if err != nil {
+					return nil, err
+				}
+				sets = append(sets, policies)
+			}
+		}
+	}
+	return mergePolicies(sets...), nil
+}
+
+// findPoliciesForSubjects returns the policies for all given subjects.
+func (l *Ladon) findPoliciesForSubjects(ctx context.Context, subjects []string) (Policies, error) {
+	if len(subjects) == 1 {
+		return l.Manager.FindPoliciesForSubject(ctx, subjects[0])
+	}
+
+	var sets []Policies
+	for _, subject := range subjects {
+		policies, err := l.Manager.FindPoliciesForSubject(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, policies)
+	}
+	return mergePolicies(sets...), nil
+}
+
+// mergePolicies returns the union of the given policy sets. Policies are identified by their ID and keep the order
+// in which they first appear. Policies without an ID are always kept.
+func mergePolicies(sets ...Policies) Policies {
+	var merged = Policies{}
+	var seen = map[string]bool{}
+	for _, policies := range sets {
+		for _, p := range policies {
+			if id := p.GetID(); id != "" {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
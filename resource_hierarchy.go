@@ -0,0 +1,71 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"strings"
+)
+
+// HierarchicalResourceManager may optionally be implemented by a Manager. If resource hierarchies are enabled (see
+// Ladon.ResourceSeparator), Ladon uses it to find the candidates of a request with a single call instead of one
+// FindRequestCandidates call per ancestor.
+type HierarchicalResourceManager interface {
+	Manager
+
+	// FindPoliciesForResources returns policies that could match any of the resources. It either returns
+	// a set of policies that apply to the resources, or a superset of it.
+	// If an error occurs, it returns nil and the error.
+	FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error)
+}
+
+// findPoliciesForResources returns the policies for all given resources. It uses FindPoliciesForResources if m
+// implements HierarchicalResourceManager and falls back to one FindPoliciesForResource call per resource.
+func findPoliciesForResources(ctx context.Context, m Manager, resources []string) (Policies, error) {
+	if hm, ok := m.(HierarchicalResourceManager); ok {
+		return hm.FindPoliciesForResources(ctx, resources)
+	}
+
+	var sets []Policies
+	for _, resource := range resources {
+		policies, err := m.FindPoliciesForResource(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, policies)
+	}
+	return mergePolicies(sets...), nil
+}
+
+// resolveResource returns the resource followed by its ancestors, starting with the closest one. For example,
+// "projects:42:documents:7" with separator ":" resolves to "projects:42:documents:7", "projects:42:documents",
+// "projects:42" and "projects". If resource hierarchies are disabled, only the resource is returned.
+func (l *Ladon) resolveResource(resource string) []string {
+	if l.ResourceSeparator == "" {
+		return []string{resource}
+	}
+
+	resources := []string{resource}
+	for i := strings.LastIndex(resource, l.ResourceSeparator); i > 0; i = strings.LastIndex(resource[:i], l.ResourceSeparator) {
+		resources = append(resources, resource[:i])
+	}
+	return resources
+}
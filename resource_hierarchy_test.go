@@ -0,0 +1,109 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+var _ HierarchicalResourceManager = new(MemoryManager)
+
+func TestResourceHierarchy(t *testing.T) {
+	ctx := context.Background()
+	manager := NewMemoryManager()
+	for _, p := range []Policy{
+		&DefaultPolicy{
+			ID:        "project-members",
+			Subjects:  []string{"peter"},
+			Actions:   []string{"view"},
+			Resources: []string{"projects:42"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:           "no-secrets",
+			Subjects:     []string{"<.*>"},
+			Actions:      []string{"<.*>"},
+			Resources:    []string{"projects:42:secrets"},
+			NotResources: []string{"projects:42:secrets:public"},
+			Effect:       DenyAccess,
+		},
+	} {
+		require.NoError(t, manager.Create(ctx, p))
+	}
+
+	for k, c := range []struct {
+		r        *Request
+		flat     bool
+		nested   bool
+		resource string
+	}{
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:42"}, flat: true, nested: true, resource: "projects:42"},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:42:documents:7"}, nested: true, resource: "projects:42"},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:4"}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:420:documents:7"}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects"}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:42:secrets:1"}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "projects:42:secrets:public:1"}, nested: true, resource: "projects:42"},
+		{r: &Request{Subject: "ken", Action: "view", Resource: "projects:42:documents:7"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			flat := &Ladon{Manager: manager}
+			assert.Equal(t, c.flat, flat.IsAllowed(ctx, c.r) == nil)
+
+			nested := &Ladon{Manager: manager, ResourceSeparator: ":"}
+			d, err := nested.Explain(ctx, c.r)
+			assert.Equal(t, c.nested, err == nil)
+			if c.resource != "" {
+				assert.Equal(t, c.resource, d.Evaluations[0].MatchedResource)
+			}
+
+			assert.Equal(t, c.nested, nested.IsAllowedBatch(ctx, []*Request{c.r})[0] == nil)
+			allowed, err := nested.FilterAllowedResources(ctx, c.r.Subject, c.r.Action, []string{c.r.Resource}, nil)
+			require.NoError(t, err)
+			assert.Equal(t, c.nested, len(allowed) == 1)
+		})
+	}
+}
+
+func TestResourceHierarchyCandidates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockManager(ctrl)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	warden := &Ladon{Manager: m, ResourceSeparator: "/"}
+
+	allow := &DefaultPolicy{ID: "allow", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"/projects"}, Effect: AllowAccess}
+	m.EXPECT().FindRequestCandidates(ctx, gomock.Eq(&Request{Subject: "peter", Action: "view", Resource: "/projects/1/docs"})).Return(Policies{}, nil)
+	m.EXPECT().FindRequestCandidates(ctx, gomock.Eq(&Request{Subject: "peter", Action: "view", Resource: "/projects/1"})).Return(Policies{}, nil)
+	m.EXPECT().FindRequestCandidates(ctx, gomock.Eq(&Request{Subject: "peter", Action: "view", Resource: "/projects"})).Return(Policies{allow}, nil)
+
+	assert.NoError(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "/projects/1/docs"}))
+}
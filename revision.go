@@ -0,0 +1,109 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// RevisionManager may optionally be implemented by a Manager to support optimistic concurrency. Every stored policy
+// has a revision which changes whenever the policy is written. Conditional updates and deletes only succeed if the
+// policy still has the revision the caller read, so that concurrent modifications are not lost silently.
+type RevisionManager interface {
+	Manager
+
+	// GetWithRevision retrieves a policy and its current revision.
+	GetWithRevision(ctx context.Context, id string) (Policy, string, error)
+
+	// UpdateIfRevision updates an existing policy if its current revision equals revision and returns the new
+	// revision. It returns a *ConflictError if the revision does not match and ErrNotFound if the policy does not
+	// exist.
+	UpdateIfRevision(ctx context.Context, policy Policy, revision string) (string, error)
+
+	// DeleteIfRevision removes a policy if its current revision equals revision. It returns a *ConflictError if the
+	// revision does not match and ErrNotFound if the policy does not exist.
+	DeleteIfRevision(ctx context.Context, id string, revision string) error
+}
+
+// ErrRevisionsNotSupported is returned by managers which wrap another Manager, such as VersionedManager, if a
+// RevisionManager method is called but the wrapped Manager does not implement RevisionManager.
+var ErrRevisionsNotSupported = &errorWithContext{
+	error:  errors.New("The manager does not support revisions"),
+	code:   http.StatusNotImplemented,
+	status: http.StatusText(http.StatusNotImplemented),
+	reason: "The policy manager does not support conditional updates and deletes.",
+}
+
+// ConflictError is returned by a RevisionManager if a policy was modified after the revision was read.
+type ConflictError struct {
+	// ID is the ID of the policy.
+	ID string
+
+	// Expected is the revision the modification was based on.
+	Expected string
+
+	// Actual is the current revision of the policy.
+	Actual string
+}
+
+// NewConflictError returns a ConflictError for the policy with the given ID.
+func NewConflictError(id, expected, actual string) error {
+	return errors.WithStack(&ConflictError{ID: id, Expected: expected, Actual: actual})
+}
+
+// IsConflict returns true if the cause of the error is a *ConflictError.
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Policy %s was modified concurrently, expected revision %s but found %s", e.ID, e.Expected, e.Actual)
+}
+
+// StatusCode returns the status code of this error.
+func (e *ConflictError) StatusCode() int {
+	return http.StatusConflict
+}
+
+// RequestID returns the ID of the request that caused the error, if applicable.
+func (e *ConflictError) RequestID() string {
+	return ""
+}
+
+// Reason returns the reason for the error, if applicable.
+func (e *ConflictError) Reason() string {
+	return "The policy was modified since it was read. Read the policy again and retry."
+}
+
+// Status returns the status text of this error.
+func (e *ConflictError) Status() string {
+	return http.StatusText(http.StatusConflict)
+}
+
+// Details returns details on the error, if applicable.
+func (e *ConflictError) Details() []map[string]interface{} {
+	return []map[string]interface{}{{"id": e.ID, "expected_revision": e.Expected, "actual_revision": e.Actual}}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// DefaultShadowTimeout is the default of Ladon.ShadowTimeout.
+var DefaultShadowTimeout = 5 * time.Second
+
+// ShadowDivergence describes an access request for which the shadow policies came to a different decision than the
+// live policies.
+type ShadowDivergence struct {
+	// Request is the access request that was evaluated.
+	Request *Request `json:"request"`
+
+	// Live is the decision that was enforced.
+	Live *Decision `json:"live"`
+
+	// Shadow is the decision of the shadow policies.
+	Shadow *Decision `json:"shadow"`
+
+	// Policies contains the IDs of the policies which decided only one of both decisions.
+	Policies []string `json:"policies"`
+}
+
+// ShadowAuditLogger is implemented by audit loggers which want to be notified about divergent shadow decisions.
+type ShadowAuditLogger interface {
+	LogShadowDivergence(ctx context.Context, d *ShadowDivergence)
+}
+
+// ShadowMetric is implemented by metrics which want to be notified about divergent shadow decisions.
+type ShadowMetric interface {
+	RequestShadowDiverged(d *ShadowDivergence)
+}
+
+func (l *Ladon) shadowed() bool {
+	return l.ShadowManager != nil || l.ShadowPolicies != nil
+}
+
+func (l *Ladon) shadowTimeout() time.Duration {
+	if l.ShadowTimeout > 0 {
+		return l.ShadowTimeout
+	}
+	return DefaultShadowTimeout
+}
+
+// detachedContext carries the values of a context but neither its deadline nor its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// shadow evaluates r against the shadow policies and reports the result if it differs from the live decision. It is
+// called in its own goroutine after the live decision has been made, so ctx may already be canceled. The evaluation
+// runs on a context which keeps the values of ctx but is only bounded by the shadow timeout.
+func (l *Ladon) shadow(ctx context.Context, r *Request, live *Decision) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, l.shadowTimeout())
+	defer cancel()
+
+	// The shadow evaluation must neither be logged nor measured like a live one.
+	s := *l
+	s.Manager = l.ShadowManager
+	s.ShadowManager = nil
+	s.ShadowPolicies = nil
+	s.AuditLogger = &AuditLoggerNoOp{}
+	s.Metric = &MetricNoOp{}
+
+	var shadow *Decision
+	if l.ShadowPolicies != nil {
+		shadow, _ = s.explainPolicies(ctx, r, l.ShadowPolicies, &Decision{Request: r})
+	} else {
+		shadow, _ = s.isAllowed(ctx, r, &Decision{Request: r})
+	}
+
+	if shadow.Effect == live.Effect {
+		return
+	}
+
+	d := &ShadowDivergence{
+		Request:  r,
+		Live:     live,
+		Shadow:   shadow,
+		Policies: divergentDeciders(live.Deciders, shadow.Deciders),
+	}
+
+	if a, ok := l.auditLogger().(ShadowAuditLogger); ok {
+		a.LogShadowDivergence(ctx, d)
+	}
+	if m, ok := l.metric().(ShadowMetric); ok {
+		m.RequestShadowDiverged(d)
+	}
+}
+
+// divergentDeciders returns the sorted IDs which are part of exactly one of a and b.
+func divergentDeciders(a, b []string) []string {
+	counts := map[string]int{}
+	for _, id := range a {
+		counts[id] |= 1
+	}
+	for _, id := range b {
+		counts[id] |= 2
+	}
+
+	ids := []string{}
+	for id, c := range counts {
+		if c != 3 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
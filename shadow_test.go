@@ -0,0 +1,205 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// shadowLogger and shadowMetric pass divergences on to a channel because they are reported asynchronously.
+type shadowLogger struct {
+	AuditLoggerNoOp
+	divergences chan *ShadowDivergence
+}
+
+func (a *shadowLogger) LogShadowDivergence(ctx context.Context, d *ShadowDivergence) {
+	a.divergences <- d
+}
+
+type shadowMetric struct {
+	MetricNoOp
+	divergences chan *ShadowDivergence
+}
+
+func (m *shadowMetric) RequestShadowDiverged(d *ShadowDivergence) {
+	m.divergences <- d
+}
+
+func nextDivergence(t *testing.T, divergences <-chan *ShadowDivergence) *ShadowDivergence {
+	select {
+	case d := <-divergences:
+		return d
+	case <-time.After(time.Second):
+		require.FailNow(t, "no divergence was reported")
+		return nil
+	}
+}
+
+// blockingManager blocks lookups until release is closed or the context is done.
+type blockingManager struct {
+	Manager
+	release chan struct{}
+	done    chan error
+}
+
+func (m *blockingManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+	}
+	m.done <- ctx.Err()
+	return m.Manager.FindRequestCandidates(ctx, r)
+}
+
+func TestLadonShadow(t *testing.T) {
+	ctx := context.Background()
+
+	allowArticles := &DefaultPolicy{
+		ID:        "allow-articles",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"<view|update>"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    AllowAccess,
+	}
+	allowViews := &DefaultPolicy{
+		ID:        "allow-views",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    AllowAccess,
+	}
+	denyUpdates := &DefaultPolicy{
+		ID:        "deny-updates",
+		Subjects:  []string{"guest"},
+		Actions:   []string{"update"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    DenyAccess,
+	}
+
+	live := NewMemoryManager()
+	require.NoError(t, live.Create(ctx, allowArticles))
+
+	candidate := NewMemoryManager()
+	require.NoError(t, candidate.Create(ctx, allowViews))
+	require.NoError(t, candidate.Create(ctx, denyUpdates))
+
+	for _, c := range []struct {
+		name   string
+		warden func(a AuditLogger, m Metric) *Ladon
+	}{
+		{
+			name: "manager",
+			warden: func(a AuditLogger, m Metric) *Ladon {
+				return &Ladon{Manager: live, ShadowManager: candidate, AuditLogger: a, Metric: m}
+			},
+		},
+		{
+			name: "policies",
+			warden: func(a AuditLogger, m Metric) *Ladon {
+				return &Ladon{Manager: live, ShadowPolicies: Policies{allowViews, denyUpdates}, AuditLogger: a, Metric: m}
+			},
+		},
+	} {
+		t.Run("shadow="+c.name, func(t *testing.T) {
+			logger := &shadowLogger{divergences: make(chan *ShadowDivergence, 10)}
+			metric := &shadowMetric{divergences: make(chan *ShadowDivergence, 10)}
+			warden := c.warden(logger, metric)
+
+			// Both agree, nothing is reported.
+			require.NoError(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"}))
+
+			// The live decision is enforced although the shadow policies deny the request.
+			r := &Request{Subject: "guest", Action: "update", Resource: "articles:1"}
+			require.NoError(t, warden.IsAllowed(ctx, r))
+
+			d := nextDivergence(t, logger.divergences)
+			assert.Equal(t, r, d.Request)
+			assert.Equal(t, Permit, d.Live.Effect)
+			assert.Equal(t, []string{"allow-articles"}, d.Live.Deciders)
+			assert.Equal(t, Deny, d.Shadow.Effect)
+			assert.Equal(t, []string{"deny-updates"}, d.Shadow.Deciders)
+			assert.Equal(t, []string{"allow-articles", "deny-updates"}, d.Policies)
+			assert.Equal(t, d, nextDivergence(t, metric.divergences))
+
+			// Explain reports the live decision as well.
+			decision, err := warden.Explain(ctx, &Request{Subject: "peter", Action: "update", Resource: "articles:1"})
+			require.NoError(t, err)
+			assert.Equal(t, Permit, decision.Effect)
+
+			d = nextDivergence(t, logger.divergences)
+			assert.Equal(t, decision, d.Live)
+			assert.Equal(t, NotApplicable, d.Shadow.Effect)
+			assert.Equal(t, []string{"allow-articles"}, d.Policies)
+			assert.Equal(t, d, nextDivergence(t, metric.divergences))
+
+			assert.Empty(t, logger.divergences)
+			assert.Empty(t, metric.divergences)
+		})
+	}
+}
+
+func TestLadonShadowAsync(t *testing.T) {
+	live := NewMemoryManager()
+	require.NoError(t, live.Create(context.Background(), &DefaultPolicy{
+		ID:        "allow",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:1"},
+		Effect:    AllowAccess,
+	}))
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+	t.Run("case=does not block the live decision", func(t *testing.T) {
+		shadow := &blockingManager{Manager: NewMemoryManager(), release: make(chan struct{}), done: make(chan error, 1)}
+		logger := &shadowLogger{divergences: make(chan *ShadowDivergence, 1)}
+		warden := &Ladon{Manager: live, ShadowManager: shadow, AuditLogger: logger}
+
+		// The caller's context is canceled as soon as the live decision is made.
+		ctx, cancel := context.WithCancel(context.Background())
+		require.NoError(t, warden.IsAllowed(ctx, r))
+		cancel()
+
+		close(shadow.release)
+		assert.NoError(t, <-shadow.done)
+		assert.Equal(t, NotApplicable, nextDivergence(t, logger.divergences).Shadow.Effect)
+	})
+
+	t.Run("case=is bounded by the shadow timeout", func(t *testing.T) {
+		shadow := &blockingManager{Manager: NewMemoryManager(), release: make(chan struct{}), done: make(chan error, 1)}
+		warden := &Ladon{Manager: live, ShadowManager: shadow, ShadowTimeout: 10 * time.Millisecond}
+
+		require.NoError(t, warden.IsAllowed(context.Background(), r))
+		select {
+		case err := <-shadow.done:
+			assert.Equal(t, context.DeadlineExceeded, err)
+		case <-time.After(time.Second):
+			require.FailNow(t, "the shadow evaluation did not time out")
+		}
+	})
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "context"
+
+// SubjectResolver resolves the roles or groups a subject belongs to, for example "role:editor" for "peter". Roles
+// and groups may themselves belong to other roles or groups which are resolved transitively by Ladon.
+type SubjectResolver interface {
+	// ResolveSubject returns the roles and groups the subject is a direct member of.
+	ResolveSubject(ctx context.Context, subject string) ([]string, error)
+}
+
+// StaticSubjectResolver is a SubjectResolver which maps subjects to the roles and groups they are a direct member of.
+type StaticSubjectResolver map[string][]string
+
+// ResolveSubject returns the roles and groups the subject is a direct member of.
+func (r StaticSubjectResolver) ResolveSubject(ctx context.Context, subject string) ([]string, error) {
+	return r[subject], nil
+}
+
+// resolveSubject returns the subject followed by all roles and groups it transitively belongs to. Every subject
+// is contained only once, so cycles in the hierarchy are resolved as well.
+func (l *Ladon) resolveSubject(ctx context.Context, subject string) ([]string, error) {
+	if l.SubjectResolver == nil {
+		return []string{subject}, nil
+	}
+
+	subjects := []string{subject}
+	seen := map[string]bool{subject: true}
+	for i := 0; i < len(subjects); i++ {
+		parents, err := l.SubjectResolver.ResolveSubject(ctx, subjects[i])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parent := range parents {
+			if !seen[parent] {
+				seen[parent] = true
+				subjects = append(subjects, parent)
+			}
+		}
+	}
+	return subjects, nil
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type failingSubjectResolver struct{}
+
+func (r *failingSubjectResolver) ResolveSubject(ctx context.Context, subject string) ([]string, error) {
+	return nil, errors.New("resolver failed")
+}
+
+func TestSubjectResolver(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{
+		Manager: NewMemoryManager(),
+		SubjectResolver: StaticSubjectResolver{
+			"peter":        {"role:editor"},
+			"ken":          {"role:viewer", "group:interns"},
+			"role:editor":  {"role:viewer"},
+			"role:viewer":  {"role:reader"},
+			"role:reader":  {"role:editor"},
+			"group:nobody": {"group:nobody"},
+		},
+	}
+
+	for _, p := range []Policy{
+		&DefaultPolicy{
+			ID:        "editors-update",
+			Subjects:  []string{"role:editor"},
+			Actions:   []string{"update"},
+			Resources: []string{"articles:<.*>"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:        "readers-view",
+			Subjects:  []string{"role:reader"},
+			Actions:   []string{"view"},
+			Resources: []string{"articles:<.*>"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:        "interns-no-secrets",
+			Subjects:  []string{"group:interns"},
+			Actions:   []string{"<.*>"},
+			Resources: []string{"articles:secret"},
+			Effect:    DenyAccess,
+		},
+		&DefaultPolicy{
+			ID:          "everyone-but-editors-comment",
+			Subjects:    []string{"<.*>"},
+			NotSubjects: []string{"role:editor"},
+			Actions:     []string{"comment"},
+			Resources:   []string{"articles:<.*>"},
+			Effect:      AllowAccess,
+		},
+	} {
+		require.NoError(t, warden.Manager.Create(ctx, p))
+	}
+
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "ken", Action: "view", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "ken", Action: "view", Resource: "articles:secret"}},
+		{r: &Request{Subject: "ken", Action: "update", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "ken", Action: "comment", Resource: "articles:1"}},
+		{r: &Request{Subject: "max", Action: "comment", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "max", Action: "view", Resource: "articles:1"}},
+		{r: &Request{Subject: "group:nobody", Action: "view", Resource: "articles:1"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(ctx, c.r) == nil)
+			assert.Equal(t, c.allowed, warden.IsAllowedBatch(ctx, []*Request{c.r})[0] == nil)
+
+			allowed, err := warden.FilterAllowedResources(ctx, c.r.Subject, c.r.Action, []string{c.r.Resource}, c.r.Context)
+			require.NoError(t, err)
+			assert.Equal(t, c.allowed, len(allowed) == 1)
+		})
+	}
+
+	d, err := warden.Explain(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"readers-view"}, d.Deciders)
+	for _, e := range d.Evaluations {
+		if e.PolicyID == "readers-view" {
+			assert.Equal(t, "role:reader", e.MatchedSubject)
+		}
+	}
+}
+
+func TestSubjectResolverCandidates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := NewMockManager(ctrl)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	warden := &Ladon{Manager: m, SubjectResolver: StaticSubjectResolver{"peter": {"role:editor"}}}
+
+	deny := &DefaultPolicy{ID: "deny", Subjects: []string{"role:editor"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: DenyAccess}
+	allow := &DefaultPolicy{ID: "allow", Subjects: []string{"<.*>"}, Actions: []string{"view"}, Resources: []string{"<.*>"}, Effect: AllowAccess}
+	m.EXPECT().FindRequestCandidates(ctx, gomock.Eq(&Request{Subject: "peter", Action: "view"})).Return(Policies{allow}, nil)
+	m.EXPECT().FindRequestCandidates(ctx, gomock.Eq(&Request{Subject: "role:editor", Action: "view"})).Return(Policies{allow, deny}, nil)
+
+	d, err := warden.Explain(ctx, &Request{Subject: "peter", Action: "view"})
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+	assert.Len(t, d.Evaluations, 2)
+	assert.Equal(t, []string{"allow", "deny"}, d.Deciders)
+
+	warden.SubjectResolver = &failingSubjectResolver{}
+	assert.EqualError(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "view"}), "resolver failed")
+	assert.EqualError(t, warden.DoPoliciesAllow(ctx, &Request{Subject: "peter", Action: "view"}, Policies{allow}), "resolver failed")
+}
+
+var _ MultiCandidateManager = new(MemoryManager)
+
+// countingCandidateManager counts the candidate lookups of a MemoryManager.
+type countingCandidateManager struct {
+	*MemoryManager
+	single, multi int
+}
+
+func (m *countingCandidateManager) FindRequestCandidates(ctx context.Context, r *Request) (Policies, error) {
+	m.single++
+	return m.MemoryManager.FindRequestCandidates(ctx, r)
+}
+
+func (m *countingCandidateManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	m.multi++
+	return m.MemoryManager.FindCandidates(ctx, subjects, resources, actions)
+}
+
+func TestMultiCandidateManager(t *testing.T) {
+	for name, wrap := range map[string]func(m Manager) Manager{
+		"manager":   func(m Manager) Manager { return m },
+		"versioned": func(m Manager) Manager { return NewVersionedManager(m, nil) },
+		"cached":    func(m Manager) Manager { return NewCachedWarden(&Ladon{Manager: m}, m, CacheConfig{}).Manager() },
+	} {
+		t.Run("wrapper="+name, func(t *testing.T) {
+			ctx := context.Background()
+			m := &countingCandidateManager{MemoryManager: NewMemoryManager()}
+			warden := &Ladon{
+				Manager:           wrap(m),
+				SubjectResolver:   StaticSubjectResolver{"peter": {"role:editor", "role:viewer"}},
+				ResourceSeparator: "/",
+				ActionGroups:      NewActionGroups(map[string][]string{"group:write": {"update", "delete"}}),
+			}
+
+			require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: "1", Subjects: []string{"role:viewer"}, Actions: []string{"group:write"}, Resources: []string{"/projects"}, Effect: AllowAccess}))
+
+			// All roles, ancestors and action groups are looked up at once.
+			assert.NoError(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "update", Resource: "/projects/1/docs"}))
+			assert.Error(t, warden.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "/projects/1/docs"}))
+			assert.Equal(t, 0, m.single)
+			assert.Equal(t, 2, m.multi)
+		})
+	}
+}
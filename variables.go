@@ -0,0 +1,204 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	variablePrefix = "${"
+	variableSuffix = "}"
+
+	contextVariablePrefix = "context."
+)
+
+// ResolveVariables replaces the policy variables in s with the values taken from request r. Supported variables are
+// ${subject}, ${action}, ${resource} and ${context.<key>} which refers to the value of key in the request's context.
+// Unknown variables are left untouched. If escape is not nil, it is applied to every value before it is inserted.
+//
+// ResolveVariables returns false if s contains a variable which can not be resolved, for example because the
+// request's context does not contain the key or its value is neither a string, a number nor a boolean.
+func ResolveVariables(s string, r *Request, escape func(string) string) (string, bool) {
+	if !strings.Contains(s, variablePrefix) {
+		return s, true
+	}
+
+	var out strings.Builder
+	for {
+		start := strings.Index(s, variablePrefix)
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(s[start:], variableSuffix)
+		if end < 0 {
+			break
+		}
+		end += start
+
+		value, known, ok := variableValue(s[start+len(variablePrefix):end], r)
+		if !known {
+			out.WriteString(s[:end+len(variableSuffix)])
+			s = s[end+len(variableSuffix):]
+			continue
+		} else if !ok {
+			return "", false
+		}
+
+		if escape != nil {
+			value = escape(value)
+		}
+		out.WriteString(s[:start])
+		out.WriteString(value)
+		s = s[end+len(variableSuffix):]
+	}
+
+	out.WriteString(s)
+	return out.String(), true
+}
+
+// variableValue returns the value of the variable with the given name. known is false if there is no such variable,
+// ok is false if the variable exists but can not be resolved for the request.
+func variableValue(name string, r *Request) (value string, known bool, ok bool) {
+	switch {
+	case name == "subject":
+		if r == nil {
+			return "", true, false
+		}
+		return r.Subject, true, true
+	case name == "action":
+		if r == nil {
+			return "", true, false
+		}
+		return r.Action, true, true
+	case name == "resource":
+		if r == nil {
+			return "", true, false
+		}
+		return r.Resource, true, true
+	case strings.HasPrefix(name, contextVariablePrefix):
+		if r == nil {
+			return "", true, false
+		}
+
+		switch v := r.Context[strings.TrimPrefix(name, contextVariablePrefix)].(type) {
+		case string:
+			return v, true, true
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return fmt.Sprintf("%v", v), true, true
+		}
+		return "", true, false
+	}
+	return "", false, false
+}
+
+// resolvePolicyVariables resolves the policy variables in the subjects, resources or actions of policy p. Values
+// inserted into regular expressions are escaped. Values inserted outside of regular expressions are turned into
+// an escaped regular expression if they contain one of the policy's delimiters, so that a value can never be
+// interpreted as a regular expression. Items containing variables which can not be resolved are removed because
+// they can not match anything.
+func resolvePolicyVariables(p Policy, haystack []string, r *Request) []string {
+	var resolved []string
+	for k, item := range haystack {
+		if !strings.Contains(item, variablePrefix) {
+			if resolved != nil {
+				resolved = append(resolved, item)
+			}
+			continue
+		}
+
+		if resolved == nil {
+			resolved = make([]string, k, len(haystack))
+			copy(resolved, haystack[:k])
+		}
+
+		if item, ok := resolveItemVariables(item, r, p.GetStartDelimiter(), p.GetEndDelimiter()); ok {
+			resolved = append(resolved, item)
+		}
+	}
+
+	if resolved == nil {
+		return haystack
+	}
+	return resolved
+}
+
+// resolveItemVariables resolves the variables of a single subject, resource or action.
+func resolveItemVariables(item string, r *Request, delimiterStart, delimiterEnd byte) (string, bool) {
+	var out strings.Builder
+	var level int
+	for i := 0; i < len(item); i++ {
+		switch item[i] {
+		case delimiterStart:
+			level++
+		case delimiterEnd:
+			level--
+		case variablePrefix[0]:
+			if !strings.HasPrefix(item[i:], variablePrefix) {
+				break
+			}
+
+			end := strings.Index(item[i:], variableSuffix)
+			if end < 0 {
+				break
+			}
+
+			value, known, ok := variableValue(item[i+len(variablePrefix):i+end], r)
+			if !known {
+				break
+			} else if !ok {
+				return "", false
+			}
+
+			if level > 0 {
+				out.WriteString(escapeRegexp(value, delimiterStart, delimiterEnd))
+			} else if strings.IndexByte(value, delimiterStart) >= 0 || strings.IndexByte(value, delimiterEnd) >= 0 {
+				out.WriteByte(delimiterStart)
+				out.WriteString(escapeRegexp(value, delimiterStart, delimiterEnd))
+				out.WriteByte(delimiterEnd)
+			} else {
+				out.WriteString(value)
+			}
+
+			i += end
+			continue
+		}
+		out.WriteByte(item[i])
+	}
+	return out.String(), true
+}
+
+// escapeRegexp quotes all regular expression meta characters in value and replaces the delimiters with their
+// hexadecimal escape sequences so they do not influence the parsing of the template.
+func escapeRegexp(value string, delimiterStart, delimiterEnd byte) string {
+	var out strings.Builder
+	for _, c := range value {
+		if c == rune(delimiterStart) || c == rune(delimiterEnd) {
+			fmt.Fprintf(&out, "\\x%02x", c)
+			continue
+		}
+		out.WriteString(regexp.QuoteMeta(string(c)))
+	}
+	return out.String()
+}
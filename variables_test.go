@@ -0,0 +1,140 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestResolveVariables(t *testing.T) {
+	r := &Request{
+		Subject:  "peter",
+		Action:   "view",
+		Resource: "articles:1",
+		Context: Context{
+			"tenant": "acme",
+			"level":  3,
+			"admin":  true,
+			"groups": []string{"a"},
+		},
+	}
+
+	for k, c := range []struct {
+		in       string
+		escape   func(string) string
+		r        *Request
+		expected string
+		ok       bool
+	}{
+		{in: "users:${subject}", expected: "users:peter", ok: true},
+		{in: "${action}:${resource}", expected: "view:articles:1", ok: true},
+		{in: "tenants:${context.tenant}:level:${context.level}:${context.admin}", expected: "tenants:acme:level:3:true", ok: true},
+		{in: "no variables", expected: "no variables", ok: true},
+		{in: "${unknown} stays", expected: "${unknown} stays", ok: true},
+		{in: "unterminated ${subject", expected: "unterminated ${subject", ok: true},
+		{in: "${context.missing}", ok: false},
+		{in: "${context.groups}", ok: false},
+		{in: "${subject}", r: new(Request), expected: "", ok: true},
+		{in: "${resource}", escape: regexp.QuoteMeta, expected: `articles:1`, ok: true},
+		{in: "${subject}", r: &Request{Subject: "a.b"}, escape: regexp.QuoteMeta, expected: `a\.b`, ok: true},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			req := r
+			if c.r != nil {
+				req = c.r
+			}
+			out, ok := ResolveVariables(c.in, req, c.escape)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.expected, out)
+		})
+	}
+
+	_, ok := ResolveVariables("${subject}", nil, nil)
+	assert.False(t, ok)
+}
+
+func TestLadonPolicyVariables(t *testing.T) {
+	ctx := context.Background()
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, p := range []Policy{
+		&DefaultPolicy{
+			ID:        "own-user",
+			Subjects:  []string{"<.*>"},
+			Actions:   []string{"update"},
+			Resources: []string{"users:${subject}"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:        "own-tenant",
+			Subjects:  []string{"<.*>"},
+			Actions:   []string{"view"},
+			Resources: []string{"tenants:<${context.tenant}|shared>:articles:<.*>"},
+			Effect:    AllowAccess,
+		},
+		&DefaultPolicy{
+			ID:        "own-tenant-admin",
+			Subjects:  []string{"${context.tenant}:admin"},
+			Actions:   []string{"delete"},
+			Resources: []string{"tenants:${context.tenant}:<.*>"},
+			Effect:    AllowAccess,
+			Conditions: Conditions{
+				"owner": &StringEqualCondition{Equals: "${subject}"},
+				"tier":  &StringMatchCondition{Matches: "^${context.tenant}-(gold|silver)$"},
+			},
+		},
+	} {
+		require.NoError(t, warden.Manager.Create(ctx, p))
+	}
+
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "peter", Action: "update", Resource: "users:peter"}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "users:ken"}},
+		{r: &Request{Subject: "<.*>", Action: "update", Resource: "users:ken"}},
+		{r: &Request{Subject: "<.*>", Action: "update", Resource: "users:<.*>"}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:acme:articles:1", Context: Context{"tenant": "acme"}}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:shared:articles:1", Context: Context{"tenant": "acme"}}, allowed: true},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:other:articles:1", Context: Context{"tenant": "acme"}}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:other:articles:1", Context: Context{"tenant": "acme|other"}}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:other:articles:1", Context: Context{"tenant": ".*"}}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:other:articles:1", Context: Context{"tenant": ">|<.*"}}},
+		{r: &Request{Subject: "peter", Action: "view", Resource: "tenants:acme:articles:1"}},
+		{r: &Request{Subject: "acme:admin", Action: "delete", Resource: "tenants:acme:1", Context: Context{"tenant": "acme", "owner": "acme:admin", "tier": "acme-gold"}}, allowed: true},
+		{r: &Request{Subject: "acme:admin", Action: "delete", Resource: "tenants:acme:1", Context: Context{"tenant": "acme", "owner": "peter", "tier": "acme-gold"}}},
+		{r: &Request{Subject: "acme:admin", Action: "delete", Resource: "tenants:acme:1", Context: Context{"tenant": "acme", "owner": "acme:admin", "tier": "other-gold"}}},
+		{r: &Request{Subject: "a.me:admin", Action: "delete", Resource: "tenants:a.me:1", Context: Context{"tenant": "a.me", "owner": "a.me:admin", "tier": "acme-gold"}}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(ctx, c.r) == nil)
+		})
+	}
+}
@@ -45,3 +45,12 @@ type Warden interface {
 	//  }
 	IsAllowed(ctx context.Context, r *Request) error
 }
+
+// BatchWarden is a Warden which is able to decide many access requests at once.
+type BatchWarden interface {
+	Warden
+
+	// IsAllowedBatch decides all requests and returns one result per request, in the same order as the requests.
+	// A result is nil if the request can be granted and an error otherwise, just like IsAllowed.
+	IsAllowedBatch(ctx context.Context, rs []*Request) []error
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheConfig configures a CachedWarden.
+type CacheConfig struct {
+	// ContextKeys lists the context keys whose values are part of the cache key. Values of all other context keys are
+	// ignored, so every key a condition depends on must be listed here. If empty, the whole context is part of the
+	// cache key.
+	ContextKeys []string
+
+	// IgnoreContext caches decisions by subject, action and resource only. Enable it only if no condition depends on
+	// the context, because a decision made for one context is served for every other context then.
+	IgnoreContext bool
+
+	// MaxEntries is the maximum number of cached decisions. If the cache is full, the least recently used decision
+	// is evicted. If it is 0, the number of cached decisions is unbounded.
+	MaxEntries int
+
+	// TTL is the duration a decision is cached for. If it is 0, decisions are cached until they are evicted or
+	// invalidated.
+	TTL time.Duration
+}
+
+// CachedWarden is a Warden which caches the decisions of another Warden. Granted, denied and forcefully denied
+// decisions are cached, other errors are not.
+//
+// Cached decisions are invalidated whenever a policy is created, updated or deleted through the Manager returned by
+// CachedWarden.Manager. Changes which bypass it are only picked up once the cached decisions expire or Invalidate is
+// called, unless the manager implements Watcher and CachedWarden.Watch is running.
+type CachedWarden struct {
+	warden  Warden
+	manager Manager
+	config  CacheConfig
+
+	sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+}
+
+type cacheEntry struct {
+	key     string
+	err     error
+	expires time.Time
+}
+
+// NewCachedWarden returns a CachedWarden which caches the decisions of w. m must be the manager w reads its policies
+// from.
+func NewCachedWarden(w Warden, m Manager, c CacheConfig) *CachedWarden {
+	return &CachedWarden{
+		warden:  w,
+		manager: m,
+		config:  c,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Manager returns a Manager which invalidates the cache after every policy it creates, updates or deletes. Use it
+// instead of the wrapped manager to modify policies. If the wrapped manager implements RevisionManager, so does the
+// returned one. The returned manager implements Watcher, MultiCandidateManager and HierarchicalResourceManager by
+// passing them to the wrapped manager.
+func (c *CachedWarden) Manager() Manager {
+	m := &invalidatingManager{Manager: c.manager, cache: c}
+	if rm, ok := c.manager.(RevisionManager); ok {
+		return &invalidatingRevisionManager{invalidatingManager: m, revisions: rm}
+	}
+	return m
+}
+
+// Invalidate removes all cached decisions.
+func (c *CachedWarden) Invalidate() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.generation++
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+// Watch invalidates the cache whenever the manager reports a change to the policies, including changes made by other
+// processes. It blocks until the context is canceled and returns an error if the manager does not implement Watcher.
+func (c *CachedWarden) Watch(ctx context.Context) error {
+	w, ok := c.manager.(Watcher)
+	if !ok {
+		return errors.WithStack(ErrWatchNotSupported)
+	}
+
+	return FollowChanges(ctx, w, func(PolicyEvent, bool) {
+		c.Invalidate()
+	})
+}
+
+// Len returns the number of cached decisions.
+func (c *CachedWarden) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+// IsAllowed returns the cached decision for r if there is one, or asks the wrapped warden otherwise.
+func (c *CachedWarden) IsAllowed(ctx context.Context, r *Request) error {
+	key, ok := c.key(r)
+	if !ok {
+		return c.warden.IsAllowed(ctx, r)
+	}
+
+	e, generation := c.get(key)
+	if e != nil {
+		return e.err
+	}
+
+	err := c.warden.IsAllowed(ctx, r)
+	if EffectOf(err) != Indeterminate {
+		c.set(key, err, generation)
+	}
+	return err
+}
+
+// get returns the cached entry for key, or nil if there is none, together with the current generation of the cache.
+func (c *CachedWarden) get(key string) (*cacheEntry, uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, c.generation
+	}
+
+	e := el.Value.(*cacheEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, c.generation
+	}
+
+	c.lru.MoveToFront(el)
+	return e, c.generation
+}
+
+// set caches err for key unless the cache was invalidated since generation was read, because the decision might
+// have been made with outdated policies then.
+func (c *CachedWarden) set(key string, err error, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	e := &cacheEntry{key: key, err: err}
+	if c.config.TTL > 0 {
+		e.expires = time.Now().Add(c.config.TTL)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(e)
+	for c.config.MaxEntries > 0 && c.lru.Len() > c.config.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *CachedWarden) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// key returns the cache key of r. Context values are serialized as a JSON object, whose keys are sorted, so equal
+// contexts always result in the same key. It returns false if r can not be cached because one of the context values
+// which are part of the key can not be serialized.
+func (c *CachedWarden) key(r *Request) (string, bool) {
+	k := struct {
+		Subject  string                 `json:"s"`
+		Action   string                 `json:"a"`
+		Resource string                 `json:"r"`
+		Context  map[string]interface{} `json:"c"`
+	}{
+		Subject:  r.Subject,
+		Action:   r.Action,
+		Resource: r.Resource,
+		Context:  map[string]interface{}{},
+	}
+
+	switch {
+	case c.config.IgnoreContext:
+	case len(c.config.ContextKeys) == 0:
+		for key, v := range r.Context {
+			k.Context[key] = v
+		}
+	default:
+		for _, key := range c.config.ContextKeys {
+			if v, ok := r.Context[key]; ok {
+				k.Context[key] = v
+			}
+		}
+	}
+
+	out, err := json.Marshal(k)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// invalidatingManager invalidates a CachedWarden after every change to the policies.
+type invalidatingManager struct {
+	Manager
+	cache *CachedWarden
+}
+
+// Create persists the policy and invalidates the cache.
+func (m *invalidatingManager) Create(ctx context.Context, policy Policy) error {
+	defer m.cache.Invalidate()
+	return m.Manager.Create(ctx, policy)
+}
+
+// Update updates an existing policy and invalidates the cache.
+func (m *invalidatingManager) Update(ctx context.Context, policy Policy) error {
+	defer m.cache.Invalidate()
+	return m.Manager.Update(ctx, policy)
+}
+
+// Delete removes a policy and invalidates the cache.
+func (m *invalidatingManager) Delete(ctx context.Context, id string) error {
+	defer m.cache.Invalidate()
+	return m.Manager.Delete(ctx, id)
+}
+
+// Watch streams the changes of policies, see Watcher. It returns ErrWatchNotSupported if the wrapped manager does not
+// implement Watcher.
+func (m *invalidatingManager) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	return watch(ctx, m.Manager, token)
+}
+
+// FindCandidates returns policies that could match a request with any of the subjects, any of the resources and
+// any of the actions, see MultiCandidateManager.
+func (m *invalidatingManager) FindCandidates(ctx context.Context, subjects, resources, actions []string) (Policies, error) {
+	return findCandidates(ctx, m.Manager, &Request{}, subjects, resources, actions)
+}
+
+// FindPoliciesForResources returns policies that could match any of the resources, see HierarchicalResourceManager.
+func (m *invalidatingManager) FindPoliciesForResources(ctx context.Context, resources []string) (Policies, error) {
+	return findPoliciesForResources(ctx, m.Manager, resources)
+}
+
+// invalidatingRevisionManager is an invalidatingManager for a RevisionManager.
+type invalidatingRevisionManager struct {
+	*invalidatingManager
+	revisions RevisionManager
+}
+
+// GetWithRevision retrieves a policy and its current revision.
+func (m *invalidatingRevisionManager) GetWithRevision(ctx context.Context, id string) (Policy, string, error) {
+	return m.revisions.GetWithRevision(ctx, id)
+}
+
+// UpdateIfRevision updates an existing policy if its current revision equals revision and invalidates the cache.
+func (m *invalidatingRevisionManager) UpdateIfRevision(ctx context.Context, policy Policy, revision string) (string, error) {
+	defer m.cache.Invalidate()
+	return m.revisions.UpdateIfRevision(ctx, policy, revision)
+}
+
+// DeleteIfRevision removes a policy if its current revision equals revision and invalidates the cache.
+func (m *invalidatingRevisionManager) DeleteIfRevision(ctx context.Context, id string, revision string) error {
+	defer m.cache.Invalidate()
+	return m.revisions.DeleteIfRevision(ctx, id, revision)
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/file"
+	. "github.com/ory/ladon/manager/memory"
+	ladonredis "github.com/ory/ladon/manager/redis"
+)
+
+type countingWarden struct {
+	Warden
+	calls int32
+}
+
+func (w *countingWarden) IsAllowed(ctx context.Context, r *Request) error {
+	atomic.AddInt32(&w.calls, 1)
+	return w.Warden.IsAllowed(ctx, r)
+}
+
+func (w *countingWarden) count() int {
+	return int(atomic.LoadInt32(&w.calls))
+}
+
+type failingWarden struct {
+	calls int
+}
+
+func (w *failingWarden) IsAllowed(ctx context.Context, r *Request) error {
+	w.calls++
+	return errors.New("backend down")
+}
+
+func newCachedWarden(t *testing.T, c CacheConfig) (*CachedWarden, *countingWarden) {
+	manager := NewMemoryManager()
+	warden := &countingWarden{Warden: &Ladon{Manager: manager}}
+	cache := NewCachedWarden(warden, manager, c)
+
+	require.NoError(t, cache.Manager().Create(context.Background(), &DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"view"},
+		Resources: []string{"articles:<.*>"},
+		Effect:    AllowAccess,
+		Conditions: Conditions{
+			"tenant": &StringEqualCondition{Equals: "acme"},
+		},
+	}))
+	return cache, warden
+}
+
+func TestCachedWarden(t *testing.T) {
+	ctx := context.Background()
+	cache, warden := newCachedWarden(t, CacheConfig{ContextKeys: []string{"tenant"}})
+
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme", "trace": "a"}}
+	require.NoError(t, cache.IsAllowed(ctx, r))
+	require.NoError(t, cache.IsAllowed(ctx, r))
+	assert.Equal(t, 1, warden.count())
+
+	// Context keys which are not part of the cache key are ignored.
+	require.NoError(t, cache.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme", "trace": "b"}}))
+	assert.Equal(t, 1, warden.count())
+
+	// Denied requests are cached as well.
+	denied := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "other"}}
+	assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, denied)))
+	assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, denied)))
+	assert.Equal(t, 2, warden.count())
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestCachedWardenContext(t *testing.T) {
+	ctx := context.Background()
+	allowed := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme"}}
+	other := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "other"}}
+
+	t.Run("case=whole context by default", func(t *testing.T) {
+		cache, warden := newCachedWarden(t, CacheConfig{})
+		require.NoError(t, cache.IsAllowed(ctx, allowed))
+		assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, other)))
+		assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1"})))
+		assert.Equal(t, 3, warden.count())
+
+		// Equal contexts share a cache entry.
+		require.NoError(t, cache.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme"}}))
+		assert.Equal(t, 3, warden.count())
+	})
+
+	t.Run("case=ignore context", func(t *testing.T) {
+		cache, warden := newCachedWarden(t, CacheConfig{IgnoreContext: true})
+		require.NoError(t, cache.IsAllowed(ctx, allowed))
+		require.NoError(t, cache.IsAllowed(ctx, other))
+		assert.Equal(t, 1, warden.count())
+	})
+}
+
+func TestCachedWardenInvalidation(t *testing.T) {
+	ctx := context.Background()
+	cache, warden := newCachedWarden(t, CacheConfig{ContextKeys: []string{"tenant"}})
+	manager := cache.Manager()
+
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme"}}
+	require.NoError(t, cache.IsAllowed(ctx, r))
+
+	deny := &DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: DenyAccess}
+	require.NoError(t, manager.Create(ctx, deny))
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(cache.IsAllowed(ctx, r)))
+
+	deny.Resources = []string{"articles:2"}
+	require.NoError(t, manager.Update(ctx, deny))
+	require.NoError(t, cache.IsAllowed(ctx, r))
+
+	require.NoError(t, manager.Delete(ctx, "1"))
+	assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, r)))
+	assert.Equal(t, 4, warden.count())
+
+	cache.Invalidate()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCachedWardenBounds(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=max entries", func(t *testing.T) {
+		cache, warden := newCachedWarden(t, CacheConfig{MaxEntries: 2})
+		for _, resource := range []string{"articles:1", "articles:2", "articles:1", "articles:3", "articles:1", "articles:2"} {
+			cache.IsAllowed(ctx, &Request{Subject: "peter", Action: "view", Resource: resource})
+		}
+
+		// articles:2 was evicted by articles:3 because articles:1 was used more recently.
+		assert.Equal(t, 4, warden.count())
+		assert.Equal(t, 2, cache.Len())
+	})
+
+	t.Run("case=ttl", func(t *testing.T) {
+		cache, warden := newCachedWarden(t, CacheConfig{TTL: 10 * time.Millisecond})
+		r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+		cache.IsAllowed(ctx, r)
+		cache.IsAllowed(ctx, r)
+		assert.Equal(t, 1, warden.count())
+
+		time.Sleep(20 * time.Millisecond)
+		cache.IsAllowed(ctx, r)
+		assert.Equal(t, 2, warden.count())
+	})
+
+	t.Run("case=errors are not cached", func(t *testing.T) {
+		warden := &failingWarden{}
+		cache := NewCachedWarden(warden, NewMemoryManager(), CacheConfig{})
+		r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+
+		assert.EqualError(t, cache.IsAllowed(ctx, r), "backend down")
+		assert.EqualError(t, cache.IsAllowed(ctx, r), "backend down")
+		assert.Equal(t, 2, warden.calls)
+		assert.Equal(t, 0, cache.Len())
+	})
+}
+
+func TestCachedWardenWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := NewMemoryManager()
+	cache := NewCachedWarden(&Ladon{Manager: manager}, manager, CacheConfig{})
+	done := make(chan error)
+	go func() {
+		done <- cache.Watch(ctx)
+	}()
+
+	// Changes which bypass CachedWarden.Manager invalidate the cache as well.
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+	policy := &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess}
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.IsAllowed(ctx, r) != nil {
+		require.True(t, time.Now().Before(deadline), "The cache was not invalidated")
+		require.NoError(t, manager.Update(ctx, policy))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	unwatchable := NewCachedWarden(&Ladon{Manager: manager}, struct{ Manager }{manager}, CacheConfig{})
+	assert.Equal(t, ErrWatchNotSupported, errors.Cause(unwatchable.Watch(context.Background())))
+
+	// Wrappers only support watching if the wrapped manager does.
+	versioned := NewVersionedManager(struct{ Manager }{manager}, nil)
+	assert.Equal(t, ErrWatchNotSupported, errors.Cause(NewCachedWarden(&Ladon{Manager: versioned}, versioned, CacheConfig{}).Watch(context.Background())))
+}
+
+func TestCachedWardenWatchManagers(t *testing.T) {
+	allow := &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles:1"}, Effect: AllowAccess}
+	deny := func(k int) *DefaultPolicy {
+		p := *allow
+		p.Description = strconv.Itoa(k)
+		p.Effect = DenyAccess
+		return &p
+	}
+
+	for name, setup := range map[string]func(t *testing.T) (m Manager, run func(ctx context.Context) error, change func(k int)){
+		"file": func(t *testing.T) (Manager, func(ctx context.Context) error, func(k int)) {
+			dir := t.TempDir()
+			writePolicyFile(t, dir, "policies.json", `{"id": "1", "subjects": ["peter"], "actions": ["view"], "resources": ["articles:1"], "effect": "allow"}`)
+			m, err := file.NewFileManager(dir, file.Config{PollInterval: 10 * time.Millisecond})
+			require.NoError(t, err)
+			return m, m.Run, func(k int) {
+				content, err := json.Marshal(deny(k))
+				require.NoError(t, err)
+				writePolicyFile(t, dir, "policies.json", string(content))
+			}
+		},
+		"redis replica": func(t *testing.T) (Manager, func(ctx context.Context) error, func(k int)) {
+			rm := newRedisManager(t)
+			require.NoError(t, rm.Create(context.Background(), allow))
+			replica, err := ladonredis.NewRedisReplica(context.Background(), rm)
+			require.NoError(t, err)
+			return replica, replica.Run, func(k int) {
+				require.NoError(t, rm.Update(context.Background(), deny(k)))
+			}
+		},
+		"versioned memory": func(t *testing.T) (Manager, func(ctx context.Context) error, func(k int)) {
+			mm := NewMemoryManager()
+			require.NoError(t, mm.Create(context.Background(), allow))
+			return NewVersionedManager(mm, nil), nil, func(k int) {
+				require.NoError(t, mm.Update(context.Background(), deny(k)))
+			}
+		},
+	} {
+		t.Run("manager="+name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			m, run, change := setup(t)
+			if run != nil {
+				go run(ctx)
+			}
+
+			cache := NewCachedWarden(&Ladon{Manager: m}, m, CacheConfig{})
+			go cache.Watch(ctx)
+
+			// Changes are made until one reaches the cache, because it might not be watching yet.
+			r := &Request{Subject: "peter", Action: "view", Resource: "articles:1"}
+			require.NoError(t, cache.IsAllowed(ctx, r))
+			deadline := time.Now().Add(5 * time.Second)
+			for k := 0; errors.Cause(cache.IsAllowed(ctx, r)) != ErrRequestForcefullyDenied; k++ {
+				require.True(t, time.Now().Before(deadline), "The cache was not invalidated")
+				change(k)
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestCachedWardenRevisions(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newCachedWarden(t, CacheConfig{ContextKeys: []string{"tenant"}})
+	manager, ok := cache.Manager().(RevisionManager)
+	require.True(t, ok)
+
+	r := &Request{Subject: "peter", Action: "view", Resource: "articles:1", Context: Context{"tenant": "acme"}}
+	require.NoError(t, cache.IsAllowed(ctx, r))
+
+	p, revision, err := manager.GetWithRevision(ctx, "1")
+	require.NoError(t, err)
+	updated := *p.(*DefaultPolicy)
+	updated.Effect = DenyAccess
+	revision, err = manager.UpdateIfRevision(ctx, &updated, revision)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(cache.IsAllowed(ctx, r)))
+
+	require.NoError(t, manager.DeleteIfRevision(ctx, "1", revision))
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, ErrRequestDenied, errors.Cause(cache.IsAllowed(ctx, r)))
+
+	// Managers without revisions are not wrapped as RevisionManager.
+	_, ok = NewCachedWarden(cache, struct{ Manager }{NewMemoryManager()}, CacheConfig{}).Manager().(RevisionManager)
+	assert.False(t, ok)
+}
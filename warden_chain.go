@@ -0,0 +1,53 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "context"
+
+// WardenChain decides access requests by asking its evaluators in order. The first evaluator whose effect is not
+// NotApplicable decides the request. If an evaluator's effect is Indeterminate, the chain fails closed and returns
+// Indeterminate as well. If no evaluator applies, the effect is NotApplicable.
+type WardenChain []Evaluator
+
+// Evaluate returns the effect of the first evaluator which applies to the request.
+func (c WardenChain) Evaluate(ctx context.Context, r *Request) (Effect, error) {
+	for _, e := range c {
+		effect, err := e.Evaluate(ctx, r)
+		if effect == Indeterminate {
+			if err == nil {
+				err = effect.Err()
+			}
+			return Indeterminate, err
+		} else if effect != NotApplicable {
+			return effect, nil
+		}
+	}
+	return NotApplicable, nil
+}
+
+// IsAllowed returns nil if the first evaluator which applies to the request grants access or an error otherwise.
+func (c WardenChain) IsAllowed(ctx context.Context, r *Request) error {
+	effect, err := c.Evaluate(ctx, r)
+	if err != nil {
+		return err
+	}
+	return effect.Err()
+}
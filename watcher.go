@@ -0,0 +1,124 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrWatchTokenExpired is returned by a Watcher if it can not resume from a token anymore, because the changes after
+// it are no longer available. Watchers must then reload all policies they depend on and watch without a token.
+var ErrWatchTokenExpired = &errorWithContext{
+	error:  errors.New("Resume token has expired"),
+	code:   http.StatusGone,
+	status: http.StatusText(http.StatusGone),
+	reason: "The changes after the resume token are no longer available.",
+}
+
+// ErrWatchNotSupported is returned by managers which wrap another Manager, such as VersionedManager, if Watch is
+// called but the wrapped Manager does not implement Watcher.
+var ErrWatchNotSupported = &errorWithContext{
+	error:  errors.New("The manager does not support watching changes"),
+	code:   http.StatusNotImplemented,
+	status: http.StatusText(http.StatusNotImplemented),
+	reason: "The policy manager does not stream changes of policies.",
+}
+
+// PolicyEvent is a change of a policy streamed by a Watcher.
+type PolicyEvent struct {
+	// Type is the kind of change.
+	Type ChangeType
+
+	// ID is the ID of the policy.
+	ID string
+
+	// Old is the policy before the change, or nil if it was created.
+	Old Policy
+
+	// New is the policy after the change, or nil if it was deleted.
+	New Policy
+
+	// Token identifies the event. Pass it to Watcher.Watch to resume watching after this event.
+	Token string
+}
+
+// Watcher may optionally be implemented by a Manager to stream changes of its policies.
+type Watcher interface {
+	// Watch streams the changes of policies in the order they were made, until the context is canceled. If token is
+	// empty, only changes made after the call are streamed. Otherwise, the changes after the event with that token
+	// are streamed, starting with those which were made already. It returns ErrWatchTokenExpired if that is not
+	// possible anymore.
+	//
+	// The channel is closed when the context is canceled, or if the receiver falls too far behind. In the latter
+	// case, call Watch again with the token of the last received event. If no event was received, changes may have
+	// been missed, just as if the token had expired.
+	Watch(ctx context.Context, token string) (<-chan PolicyEvent, error)
+}
+
+// watch calls Watch on m, or returns ErrWatchNotSupported if m does not implement Watcher.
+func watch(ctx context.Context, m Manager, token string) (<-chan PolicyEvent, error) {
+	w, ok := m.(Watcher)
+	if !ok {
+		return nil, errors.WithStack(ErrWatchNotSupported)
+	}
+	return w.Watch(ctx, token)
+}
+
+// FollowChanges calls f for every change streamed by w until the context is canceled. It resumes watching whenever
+// the channel is closed. If changes were missed, because the resume token expired or because the receiver fell
+// behind before the first event, f is called with reset set to true and an empty event, and the receiver must
+// reload all policies it depends on.
+func FollowChanges(ctx context.Context, w Watcher, f func(e PolicyEvent, reset bool)) error {
+	var token string
+	var reset bool
+	for {
+		events, err := w.Watch(ctx, token)
+		if errors.Cause(err) == ErrWatchTokenExpired {
+			token, reset = "", true
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// Reset only after subscribing again, so no change is missed between reloading and watching.
+		if reset {
+			f(PolicyEvent{}, true)
+			reset = false
+		}
+
+		for e := range events {
+			token = e.Token
+			f(e, false)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// The receiver fell behind before the first event, so there is no token to resume from.
+		if token == "" {
+			reset = true
+		}
+	}
+}
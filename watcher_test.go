@@ -0,0 +1,234 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func receiveEvent(t *testing.T, events <-chan PolicyEvent) PolicyEvent {
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "The watch ended unexpectedly")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a policy event")
+		return PolicyEvent{}
+	}
+}
+
+func TestMemoryManagerWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	before := &DefaultPolicy{ID: "0", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}}
+	require.NoError(t, m.Create(ctx, before))
+
+	events, err := m.Watch(ctx, "")
+	require.NoError(t, err)
+
+	created := &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}}
+	updated := &DefaultPolicy{ID: "1", Subjects: []string{"ken"}, Actions: []string{"view"}, Resources: []string{"articles"}}
+	require.NoError(t, m.Create(ctx, created))
+	require.NoError(t, m.Update(ctx, updated))
+	require.NoError(t, m.Delete(ctx, "1"))
+	require.NoError(t, m.Delete(ctx, "1"))
+
+	first := receiveEvent(t, events)
+	assert.Equal(t, PolicyCreated, first.Type)
+	assert.Equal(t, "1", first.ID)
+	assert.Nil(t, first.Old)
+	assert.Equal(t, created, first.New)
+
+	e := receiveEvent(t, events)
+	assert.Equal(t, PolicyUpdated, e.Type)
+	assert.Equal(t, created, e.Old)
+	assert.Equal(t, updated, e.New)
+
+	last := receiveEvent(t, events)
+	assert.Equal(t, PolicyDeleted, last.Type)
+	assert.Equal(t, updated, last.Old)
+	assert.Nil(t, last.New)
+
+	// Deleting a missing policy is not a change, so the next event is this update.
+	require.NoError(t, m.Update(ctx, before))
+	assert.Equal(t, PolicyUpdated, receiveEvent(t, events).Type)
+
+	// Resuming replays the changes after the token.
+	resumed, err := m.Watch(ctx, first.Token)
+	require.NoError(t, err)
+	for _, expected := range []ChangeType{PolicyUpdated, PolicyDeleted, PolicyUpdated} {
+		assert.Equal(t, expected, receiveEvent(t, resumed).Type)
+	}
+
+	_, err = m.Watch(ctx, "not-a-token")
+	assert.Error(t, err)
+	_, err = m.Watch(ctx, "1000")
+	assert.Equal(t, ErrWatchTokenExpired, errors.Cause(err))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestMemoryManagerWatchExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	events, err := m.Watch(ctx, "")
+	require.NoError(t, err)
+
+	policy := &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"view"}, Resources: []string{"articles"}}
+	require.NoError(t, m.Create(ctx, policy))
+	first := receiveEvent(t, events)
+
+	// A receiver which falls behind the retained changes is disconnected and can not resume.
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, m.Update(ctx, policy))
+	}
+	for range events {
+	}
+
+	_, err = m.Watch(ctx, first.Token)
+	assert.Equal(t, ErrWatchTokenExpired, errors.Cause(err))
+}
+
+func TestFollowChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	received := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- FollowChanges(ctx, m, func(e PolicyEvent, reset bool) {
+			select {
+			case received <- fmt.Sprintf("%s %s %t", e.Type, e.ID, reset):
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	next := func() string {
+		select {
+		case r := <-received:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a policy event")
+			return ""
+		}
+	}
+
+	// Create policies until FollowChanges has subscribed, the events of earlier policies are not received.
+	policy := &DefaultPolicy{ID: "1"}
+	require.NoError(t, m.Create(ctx, policy))
+	for subscribed := false; !subscribed; {
+		require.NoError(t, m.Update(ctx, policy))
+		select {
+		case r := <-received:
+			require.Equal(t, "update 1 false", r)
+			subscribed = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	require.NoError(t, m.Delete(ctx, "1"))
+	for r := next(); r != "delete 1 false"; r = next() {
+		require.Equal(t, "update 1 false", r)
+	}
+
+	// Changes are missed if the receiver falls behind, which is reported as a reset.
+	require.NoError(t, m.Create(ctx, policy))
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, m.Update(ctx, policy))
+	}
+	for r := next(); r != "  true"; r = next() {
+		require.NotEqual(t, "delete 1 false", r)
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+// subscribedWatcher signals every successful call to Watch.
+type subscribedWatcher struct {
+	Watcher
+	subscribed chan struct{}
+}
+
+func (w *subscribedWatcher) Watch(ctx context.Context, token string) (<-chan PolicyEvent, error) {
+	events, err := w.Watcher.Watch(ctx, token)
+	if err == nil {
+		select {
+		case w.subscribed <- struct{}{}:
+		default:
+		}
+	}
+	return events, err
+}
+
+func TestFollowChangesOverflowBeforeFirstEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	w := &subscribedWatcher{Watcher: m, subscribed: make(chan struct{}, 1)}
+	received := make(chan bool)
+	done := make(chan error)
+	go func() {
+		done <- FollowChanges(ctx, w, func(e PolicyEvent, reset bool) {
+			select {
+			case received <- reset:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	<-w.subscribed
+
+	// More changes than are retained happen before the receiver gets the first one.
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, m.Create(ctx, &DefaultPolicy{ID: fmt.Sprintf("%d", i)}))
+	}
+
+	timeout := time.After(5 * time.Second)
+	for reset := false; !reset; {
+		select {
+		case reset = <-received:
+		case <-timeout:
+			t.Fatal("The missed changes were not reported")
+		}
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}